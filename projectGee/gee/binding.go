@@ -0,0 +1,368 @@
+package gee
+
+/*
+binding: 把请求中的数据填充到结构体, 成功之后再用 Engine.Validator 校验 (见 validation.go)
+
+	type Query struct {
+		Page  int       `form:"page"`
+		Tags  []string  `form:"tag"`
+		Since time.Time `form:"since" time_format:"2006-01-02"`
+		Owner struct {
+			Name string `form:"name"` // ?owner.name=daz
+		} `form:"owner"`
+	}
+
+json 使用 encoding/json 的 `json` 标签, query 与 form 使用 `form` 标签, 路由参数使用 `uri` 标签.
+没有标签时使用字段名, "-" 表示跳过; 命名的嵌套结构体以 "name." 作为前缀, 匿名嵌入的结构体直接展开.
+*/
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMultipartMemory is the memory used to parse multipart forms
+const defaultMultipartMemory = 32 << 20
+
+// BindingError describes a value that could not be bound to a field
+type BindingError struct {
+	Field  string // path of the struct field, e.g. "Owner.Name"
+	Key    string // key in the source, e.g. "owner.name"
+	Source string // "json", "query", "form" or "uri"
+	Value  string
+	Err    error
+}
+
+func (e *BindingError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("binding %s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("binding %s %q to %s: %v", e.Source, e.Key, e.Field, e.Err)
+}
+
+func (e *BindingError) Unwrap() error {
+	return e.Err
+}
+
+// BindingErrors collects every field that failed to bind in a request
+type BindingErrors []*BindingError
+
+func (e BindingErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap exposes the underlying errors to errors.Is and errors.As
+func (e BindingErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+var (
+	errEmptyBody = errors.New("request body is empty")
+	textType     = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// Bind picks a binding from the request: the query string for requests
+// without a body, otherwise JSON or form by Content-Type.
+// Path params are not included, use BindURI for them.
+func (c *Context) Bind(obj interface{}) error {
+	if c.Method == http.MethodGet || c.Method == http.MethodHead || c.Req.ContentLength == 0 {
+		return c.BindQuery(obj)
+	}
+
+	contentType := c.Req.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return c.BindJSON(obj)
+	case mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data":
+		return c.BindForm(obj)
+	}
+	return BindingErrors{{Source: "body", Err: fmt.Errorf("unsupported Content-Type %q", contentType)}}
+}
+
+// BindJSON decodes the request body as JSON
+func (c *Context) BindJSON(obj interface{}) error {
+	if err := c.decodeJSON(obj); err != nil {
+		return err
+	}
+	return c.validate(obj)
+}
+
+func (c *Context) decodeJSON(obj interface{}) error {
+	if c.Req.Body == nil {
+		return BindingErrors{{Source: "json", Err: errEmptyBody}}
+	}
+	if err := json.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		bindErr := &BindingError{Source: "json", Err: err}
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			bindErr.Err = errEmptyBody
+		case errors.As(err, &typeErr):
+			bindErr.Field, bindErr.Key, bindErr.Value = typeErr.Field, typeErr.Field, typeErr.Value
+			bindErr.Err = fmt.Errorf("cannot use %s as %s", typeErr.Value, typeErr.Type)
+		}
+		return BindingErrors{bindErr}
+	}
+	return nil
+}
+
+// BindQuery binds the query string using `form` tags
+func (c *Context) BindQuery(obj interface{}) error {
+	if err := bindValues(obj, c.Req.URL.Query(), "form", "query"); err != nil {
+		return err
+	}
+	return c.validate(obj)
+}
+
+// BindForm binds the url-encoded or multipart form, including the query
+// string, using `form` tags
+func (c *Context) BindForm(obj interface{}) error {
+	if err := c.parseForm(); err != nil {
+		return BindingErrors{{Source: "form", Err: err}}
+	}
+	if err := bindValues(obj, c.Req.Form, "form", "form"); err != nil {
+		return err
+	}
+	return c.validate(obj)
+}
+
+// BindURI binds the path params using `uri` tags
+func (c *Context) BindURI(obj interface{}) error {
+	values := make(map[string][]string, len(c.Params))
+	for key, value := range c.Params {
+		values[key] = []string{value}
+	}
+	if err := bindValues(obj, values, "uri", "uri"); err != nil {
+		return err
+	}
+	return c.validate(obj)
+}
+
+// validate runs the engine's Validator on a bound struct
+func (c *Context) validate(obj interface{}) error {
+	if c.engine != nil && c.engine.Validator != nil {
+		return c.engine.Validator.ValidateStruct(obj)
+	}
+	return DefaultValidator.ValidateStruct(obj)
+}
+
+func (c *Context) parseForm() error {
+	mediaType, _, _ := mime.ParseMediaType(c.Req.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		_, err := c.MultipartForm()
+		return err
+	}
+	return c.Req.ParseForm()
+}
+
+func bindValues(obj interface{}, values map[string][]string, tag string, source string) error {
+	v := reflect.ValueOf(obj)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return BindingErrors{{Source: source, Err: fmt.Errorf("expected a pointer to a struct, got %T", obj)}}
+	}
+
+	b := binder{values: values, tag: tag, source: source}
+	b.bindStruct(v.Elem(), "", "")
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return nil
+}
+
+type binder struct {
+	values map[string][]string
+	tag    string
+	source string
+	errs   BindingErrors
+}
+
+func (b *binder) bindStruct(v reflect.Value, keyPrefix string, fieldPrefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		key := sf.Tag.Get(b.tag)
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = sf.Name
+		}
+
+		field := v.Field(i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType && !reflect.PointerTo(ft).Implements(textType) {
+			// 匿名嵌入直接展开, 命名字段加上前缀
+			if sf.Anonymous && sf.Tag.Get(b.tag) == "" {
+				b.bindStruct(allocate(field), keyPrefix, fieldPrefix)
+			} else if b.hasPrefix(keyPrefix + key + ".") {
+				b.bindStruct(allocate(field), keyPrefix+key+".", fieldPrefix+sf.Name+".")
+			}
+			continue
+		}
+
+		values, ok := b.values[keyPrefix+key]
+		if !ok {
+			continue
+		}
+		if err := setField(field, sf, values); err != nil {
+			value := ""
+			if len(values) > 0 {
+				value = values[0]
+			}
+			b.errs = append(b.errs, &BindingError{
+				Field:  fieldPrefix + sf.Name,
+				Key:    keyPrefix + key,
+				Source: b.source,
+				Value:  value,
+				Err:    err,
+			})
+		}
+	}
+}
+
+func (b *binder) hasPrefix(prefix string) bool {
+	for key := range b.values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allocate dereferences v, allocating nil pointers on the way
+func allocate(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func setField(field reflect.Value, sf reflect.StructField, values []string) error {
+	field = allocate(field)
+	if field.Kind() != reflect.Slice || field.Type().Elem().Kind() == reflect.Uint8 {
+		if len(values) == 0 {
+			return nil
+		}
+		return setValue(field, sf, values[0])
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, value := range values {
+		if err := setValue(allocate(slice.Index(i)), sf, value); err != nil {
+			return err
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+// setValue converts a single string into v
+func setValue(v reflect.Value, sf reflect.StructField, value string) error {
+	if v.Kind() != reflect.String && value == "" {
+		// 空值保持零值
+		return nil
+	}
+
+	switch {
+	case v.Type() == timeType:
+		// time.Time 也实现了 TextUnmarshaler, 需要先处理 time_format
+		return setTime(v, sf, value)
+	case v.CanAddr() && v.Addr().Type().Implements(textType):
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// []byte
+		v.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// setTime parses value with the `time_format` tag, RFC3339 by default.
+// "unix" accepts seconds since the epoch.
+func setTime(v reflect.Value, sf reflect.StructField, value string) error {
+	layout := sf.Tag.Get("time_format")
+	if layout == "unix" {
+		sec, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(time.Unix(sec, 0)))
+		return nil
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,257 @@
+package gee
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Paging struct {
+	Page int `form:"page" json:"page"`
+	Size int `form:"size" json:"size"`
+}
+
+type bindTarget struct {
+	Paging
+	Name    string        `form:"name" json:"name" uri:"name"`
+	ID      uint64        `uri:"id"`
+	Active  *bool         `form:"active" json:"active"`
+	Tags    []string      `form:"tag" json:"tags"`
+	Scores  []int         `form:"score"`
+	Since   time.Time     `form:"since" time_format:"2006-01-02"`
+	Timeout time.Duration `form:"timeout"`
+	Owner   struct {
+		Name string `form:"name" json:"name"`
+		Age  int    `form:"age" json:"age"`
+	} `form:"owner" json:"owner"`
+	Ignored string `form:"-"`
+}
+
+func bindRequest(method, target, contentType, body string, params map[string]string) *Context {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	c := &Context{}
+	c.reset(httptest.NewRecorder(), req)
+	c.Params = params
+	return c
+}
+
+func TestBindQuery(t *testing.T) {
+	query := "page=2&name=daz&active=true&tag=a&tag=b&score=1&score=2&since=2023-05-09&timeout=1m&owner.name=geek&owner.age=7&Ignored=x"
+	c := bindRequest("GET", "/search?"+query, "", "", nil)
+
+	var obj bindTarget
+	if err := c.Bind(&obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Page != 2 || obj.Name != "daz" || obj.Active == nil || !*obj.Active || obj.Ignored != "" {
+		t.Errorf("unexpected result %+v", obj)
+	}
+	if !reflect.DeepEqual(obj.Tags, []string{"a", "b"}) || !reflect.DeepEqual(obj.Scores, []int{1, 2}) {
+		t.Errorf("unexpected slices %v %v", obj.Tags, obj.Scores)
+	}
+	if obj.Since.Format("2006-01-02") != "2023-05-09" || obj.Timeout != time.Minute {
+		t.Errorf("unexpected time values %v %v", obj.Since, obj.Timeout)
+	}
+	if obj.Owner.Name != "geek" || obj.Owner.Age != 7 {
+		t.Errorf("unexpected nested struct %+v", obj.Owner)
+	}
+}
+
+func TestBindBody(t *testing.T) {
+	c := bindRequest("POST", "/users", "application/json; charset=utf-8", `{"name":"daz","tags":["a"],"owner":{"age":3},"page":1}`, nil)
+	var obj bindTarget
+	if err := c.Bind(&obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "daz" || obj.Owner.Age != 3 || obj.Page != 1 || len(obj.Tags) != 1 {
+		t.Errorf("unexpected JSON result %+v", obj)
+	}
+
+	form := url.Values{"name": {"daz"}, "size": {"20"}}
+	c = bindRequest("POST", "/users?page=3", "application/x-www-form-urlencoded", form.Encode(), nil)
+	obj = bindTarget{}
+	if err := c.Bind(&obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "daz" || obj.Size != 20 || obj.Page != 3 {
+		t.Errorf("unexpected form result %+v", obj)
+	}
+
+	c = bindRequest("PUT", "/users", "text/csv", "a,b", nil)
+	if err := c.Bind(&obj); err == nil {
+		t.Error("unsupported content types should fail")
+	}
+}
+
+func TestBindURI(t *testing.T) {
+	c := bindRequest("GET", "/users/daz/42", "", "", map[string]string{"name": "daz", "id": "42"})
+	var obj bindTarget
+	if err := c.BindURI(&obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Name != "daz" || obj.ID != 42 {
+		t.Errorf("unexpected result %+v", obj)
+	}
+}
+
+func TestBindingErrors(t *testing.T) {
+	c := bindRequest("GET", "/search?page=x&owner.age=-&score=1&score=two", "", "", nil)
+	var obj bindTarget
+	err := c.Bind(&obj)
+
+	var errs BindingErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Fatalf("expected 3 binding errors, got %v", err)
+	}
+	fields := []string{errs[0].Field, errs[1].Field, errs[2].Field}
+	if !reflect.DeepEqual(fields, []string{"Page", "Scores", "Owner.Age"}) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if errs[2].Key != "owner.age" || errs[2].Source != "query" {
+		t.Errorf("unexpected error %+v", errs[2])
+	}
+
+	c = bindRequest("POST", "/users", "application/json", `{"page":"one"}`, nil)
+	if err := c.BindJSON(&obj); !errors.As(err, &errs) || errs[0].Field != "page" {
+		t.Errorf("JSON type errors should name the field, got %v", err)
+	}
+
+	c = bindRequest(http.MethodPost, "/users", "application/json", "", nil)
+	if err := c.BindJSON(&obj); err == nil {
+		t.Error("empty bodies should fail")
+	}
+}
+
+type signUp struct {
+	Name    string   `json:"name" validate:"required,min=3,max=8"`
+	Email   string   `json:"email" validate:"required,email"`
+	Role    string   `json:"role" validate:"omitempty,oneof=admin user"`
+	Age     int      `json:"age" validate:"gt=0,lt=150"`
+	Invite  string   `json:"invite" validate:"omitempty,invite"`
+	Address *address `json:"address"`
+	Tags    []tag    `json:"tags" validate:"max=2"`
+}
+
+type address struct {
+	City string `json:"city" validate:"required,alpha"`
+}
+
+type tag struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// newSignUpValidator knows the custom invite rule of signUp
+func newSignUpValidator() *TagValidator {
+	v := NewTagValidator()
+	v.RegisterValidation("invite", func(field reflect.Value, _ string) error {
+		if !strings.HasPrefix(field.String(), "GEE-") {
+			return errors.New("must be a valid invite code")
+		}
+		return nil
+	})
+	return v
+}
+
+func TestValidation(t *testing.T) {
+	v := newSignUpValidator()
+
+	valid := signUp{Name: "daz", Email: "daz@example.com", Role: "admin", Age: 20, Invite: "GEE-1"}
+	if err := v.ValidateStruct(&valid); err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+
+	invalid := signUp{
+		Name:    "da",
+		Email:   "not an email",
+		Role:    "root",
+		Invite:  "x",
+		Address: &address{City: "B3"},
+		Tags:    []tag{{"a"}, {""}},
+	}
+	err := v.ValidateStruct(&invalid)
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	got := make([]string, len(errs))
+	for i, fe := range errs {
+		got[i] = fe.Field + ":" + fe.Rule
+	}
+	expected := []string{"Name:min", "Email:email", "Role:oneof", "Age:gt", "Invite:invite", "Address.City:alpha", "Tags[1].Name:required"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestBindValidateFail(t *testing.T) {
+	r := New()
+	r.Validator = newSignUpValidator()
+	r.POST("/signup", func(c *Context) {
+		var obj signUp
+		if err := c.Bind(&obj); err != nil {
+			c.Fail(http.StatusBadRequest, err)
+			return
+		}
+		c.String(http.StatusOK, obj.Name)
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/signup", strings.NewReader(`{"name":"daz","age":20}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	expected := `{"errors":[{"field":"Email","message":"is required","rule":"required"}],"message":"validation failed"}` + "\n"
+	if w.Code != http.StatusBadRequest || w.Body.String() != expected {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestValidationRuleError(t *testing.T) {
+	type item struct {
+		Count int `validate:"min=abc"`
+	}
+	type order struct {
+		Name  string `validate:"required,uniq"`
+		Items []item
+	}
+
+	v := NewTagValidator()
+	var ruleErr *RuleError
+	if err := v.Check(order{}); !errors.As(err, &ruleErr) || ruleErr.Field != "Name" || ruleErr.Rule != "uniq" {
+		t.Fatalf("expected unknown rule uniq on Name, got %v", err)
+	}
+	// 校验时返回错误而不是 panic
+	if err := v.ValidateStruct(&order{Name: "a"}); !errors.As(err, &ruleErr) {
+		t.Fatalf("expected a RuleError, got %v", err)
+	}
+
+	v.RegisterValidation("uniq", func(reflect.Value, string) error { return nil })
+	if err := v.Check(&order{}); !errors.As(err, &ruleErr) || ruleErr.Field != "Items.Count" || ruleErr.Param != "abc" {
+		t.Fatalf("expected invalid parameter on Items.Count, got %v", err)
+	}
+	if err := newSignUpValidator().Check(signUp{}); err != nil {
+		t.Errorf("expected valid tags, got %v", err)
+	}
+
+	// 标签写错是服务端的问题: 500, 细节不发给客户端
+	r := New()
+	r.GET("/items", func(c *Context) {
+		var it item
+		if err := c.Bind(&it); err != nil {
+			c.Fail(http.StatusBadRequest, err)
+		}
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/items?count=1", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "min") {
+		t.Errorf("expected a generic 500, got %d %q", w.Code, w.Body.String())
+	}
+}
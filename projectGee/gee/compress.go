@@ -0,0 +1,342 @@
+package gee
+
+/*
+middleware: 响应压缩
+
+	r.Use(gee.Compress())
+
+按 Accept-Encoding 协商编码 (默认支持 gzip 与 deflate, 可用 RegisterEncoder 扩展, 例如 br);
+响应体先缓冲到 MinLength, 太小的响应以及已经压缩过的类型 (图片, 视频, 压缩包...) 原样发送.
+Flush 会立即开始压缩并把已有数据推给客户端, 流式响应同样可用.
+Recovery 要注册在 Compress 之前: handler panic 时缓冲的部分响应会被丢弃, 由外层的 Recovery 回复 500.
+*/
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// EncoderFunc returns a writer compressing into w. The writer must have a
+// Reset(io.Writer) method, like the gzip and flate writers, so it can be reused.
+type EncoderFunc func(w io.Writer, level int) (io.WriteCloser, error)
+
+type resetter interface {
+	Reset(w io.Writer)
+}
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFunc{
+		"gzip": func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		"deflate": func(w io.Writer, level int) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		},
+	}
+	// encoderOrder is the default preference, in registration order
+	encoderOrder = []string{"gzip", "deflate"}
+)
+
+// RegisterEncoder adds a content encoding, e.g. "br" backed by a brotli
+// package. Registered encodings are preferred in registration order.
+func RegisterEncoder(name string, fn EncoderFunc) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	name = strings.ToLower(name)
+	if _, ok := encoders[name]; !ok {
+		encoderOrder = append(encoderOrder, name)
+	}
+	encoders[name] = fn
+}
+
+// CompressConfig configures the compression middleware
+type CompressConfig struct {
+	// Level is passed to the encoder, 0 selects the default level
+	Level int
+	// MinLength is the smallest body that gets compressed, 1024 by default
+	MinLength int
+	// Encodings are the content encodings to offer in order of preference,
+	// all registered encoders by default
+	Encodings []string
+	// ExcludedContentTypes are Content-Type prefixes sent uncompressed,
+	// by default already compressed images, audio, video, fonts and archives
+	ExcludedContentTypes []string
+}
+
+var defaultExcludedContentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/x-bzip2",
+}
+
+// Compress compresses responses with the default config
+func Compress() HandlerFunc {
+	return CompressWithConfig(CompressConfig{})
+}
+
+// CompressWithConfig returns a compression middleware for config
+func CompressWithConfig(config CompressConfig) HandlerFunc {
+	if config.Level == 0 {
+		config.Level = flate.DefaultCompression
+	}
+	if config.MinLength <= 0 {
+		config.MinLength = 1024
+	}
+	if config.ExcludedContentTypes == nil {
+		config.ExcludedContentTypes = defaultExcludedContentTypes
+	}
+
+	encodersMu.RLock()
+	if config.Encodings == nil {
+		config.Encodings = append([]string(nil), encoderOrder...)
+	}
+	// 每种编码一个 writer 池
+	pools := make(map[string]*sync.Pool, len(config.Encodings))
+	for _, name := range config.Encodings {
+		fn, ok := encoders[name]
+		if !ok {
+			encodersMu.RUnlock()
+			panic("gee: unknown content encoding " + name)
+		}
+		pools[name] = &sync.Pool{New: func() interface{} {
+			w, err := fn(io.Discard, config.Level)
+			if err != nil {
+				panic("gee: cannot create " + name + " encoder: " + err.Error())
+			}
+			if _, ok := w.(resetter); !ok {
+				panic("gee: " + name + " encoder has no Reset(io.Writer) method")
+			}
+			return w
+		}}
+	}
+	encodersMu.RUnlock()
+
+	return func(c *Context) {
+		header := c.Writer.Header()
+		header.Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.Req.Header.Get("Accept-Encoding"), config.Encodings)
+		if encoding == "" || c.Method == http.MethodHead || c.Req.Header.Get("Upgrade") != "" {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{
+			ResponseWriter: c.Writer,
+			config:         &config,
+			encoding:       encoding,
+			pool:           pools[encoding],
+		}
+		c.Writer = w
+		defer func() {
+			if err := recover(); err != nil {
+				// 丢掉还没发出的部分响应, 外层的 Recovery 才能回复 500
+				w.abort()
+				c.Writer = w.ResponseWriter
+				panic(err)
+			}
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the accepted encoding with the highest q-value,
+// ties are broken by the order of offered
+func negotiateEncoding(accept string, offered []string) string {
+	best, bestQ := "", 0.0
+	for _, name := range offered {
+		q := acceptQuality(accept, name)
+		if q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// acceptQuality returns the q-value given to encoding by an Accept-Encoding header
+func acceptQuality(accept string, encoding string) float64 {
+	q, wildcard := 0.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = f
+			}
+		}
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case encoding:
+			return quality
+		case "*":
+			wildcard = quality
+		}
+	}
+	if wildcard >= 0 {
+		q = wildcard
+	}
+	return q
+}
+
+// compressWriter buffers the start of the body to decide whether the
+// response is worth compressing, then streams through the encoder.
+// Status and Size report the inner writer, i.e. the compressed bytes sent.
+type compressWriter struct {
+	ResponseWriter
+	config   *CompressConfig
+	encoding string
+	pool     *sync.Pool
+
+	buf         []byte
+	decided     bool
+	compressing bool
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if !w.decided && len(w.buf) > 0 && code >= 200 {
+		// body 已经开始写了, 和直接写出时一样忽略
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) < w.config.MinLength {
+			return len(data), nil
+		}
+		w.decide(true)
+		return len(data), w.flushBuffer()
+	}
+	if w.compressing {
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Written also counts a body still held in the buffer
+func (w *compressWriter) Written() bool {
+	if !w.decided {
+		return len(w.buf) > 0
+	}
+	return w.ResponseWriter.Written()
+}
+
+// decide fixes the headers, compressing when allowed and large enough
+func (w *compressWriter) decide(largeEnough bool) {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// 与 net/http 一样根据内容推断类型, 以便判断是否值得压缩
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	w.compressing = largeEnough && w.compressible()
+	if w.compressing {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoding)
+		w.encoder = w.pool.Get().(io.WriteCloser)
+		w.encoder.(resetter).Reset(w.ResponseWriter)
+	}
+}
+
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		return false
+	}
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, excluded := range w.config.ExcludedContentTypes {
+		if strings.HasPrefix(contentType, excluded) {
+			return false
+		}
+	}
+	return true
+}
+
+func (w *compressWriter) flushBuffer() error {
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.compressing {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if !w.decided {
+		w.decide(len(w.buf) >= w.config.MinLength)
+		w.flushBuffer()
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Flush starts compressing right away, so streamed responses reach the
+// client without waiting for MinLength bytes
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+		w.flushBuffer()
+	}
+	if f, ok := w.encoder.(interface{ Flush() error }); ok && w.compressing {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.decided = true
+	return w.ResponseWriter.Hijack()
+}
+
+// abort drops what was not sent after a panic. A compressed stream that
+// already started is left without its trailer, so it reads as truncated.
+func (w *compressWriter) abort() {
+	w.buf = nil
+	w.decided = true
+	if w.compressing {
+		w.encoder.(resetter).Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+		w.compressing = false
+	}
+}
+
+// close writes what is still buffered and finishes the compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		if len(w.buf) == 0 {
+			// 没有 body, 状态码留给 router 或者外层 (例如 Recovery) 发出
+			return
+		}
+		w.decide(len(w.buf) >= w.config.MinLength)
+		w.flushBuffer()
+	}
+	if w.compressing {
+		w.encoder.Close()
+		w.encoder.(resetter).Reset(io.Discard)
+		w.pool.Put(w.encoder)
+		w.encoder = nil
+		w.compressing = false
+	}
+}
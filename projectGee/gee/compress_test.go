@@ -0,0 +1,140 @@
+package gee
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	r := New()
+	r.Use(Compress())
+	large := strings.Repeat("gee ", 512)
+	r.GET("/large", func(c *Context) { c.JSON(http.StatusCreated, H{"text": large}) })
+	r.GET("/small", func(c *Context) { c.String(http.StatusOK, "small") })
+	r.GET("/png", func(c *Context) { c.Data(http.StatusOK, []byte("\x89PNG\r\n\x1a\n"+large)) })
+	r.GET("/stream", func(c *Context) {
+		c.SetHeader("Content-Type", "text/event-stream")
+		c.Status(http.StatusOK)
+		c.Writer.Write([]byte("data: 1\n\n"))
+		c.Writer.(http.Flusher).Flush()
+		c.Writer.Write([]byte("data: 2\n\n"))
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		encoding string
+		code     int
+	}{
+		{"/large", "gzip, deflate", "gzip", http.StatusCreated},
+		{"/large", "deflate, gzip;q=0.5", "deflate", http.StatusCreated},
+		{"/large", "br", "", http.StatusCreated},
+		{"/large", "*;q=0, identity", "", http.StatusCreated},
+		{"/large", "", "", http.StatusCreated},
+		{"/small", "gzip", "", http.StatusOK},
+		{"/png", "gzip", "", http.StatusOK},
+		// Flush 之后数据不足 MinLength 也会压缩
+		{"/stream", "gzip", "gzip", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%s %q: expected %d, got %d", tt.path, tt.accept, tt.code, w.Code)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s %q: expected encoding %q, got %q", tt.path, tt.accept, tt.encoding, got)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s %q: expected Vary Accept-Encoding, got %q", tt.path, tt.accept, got)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected application/json, got %q", w.Header().Get("Content-Type"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil || !strings.Contains(string(body), large) {
+		t.Errorf("gzip body does not decode to the response, err %v", err)
+	}
+}
+
+func TestCompressWriteHeaderNow(t *testing.T) {
+	r := New()
+	r.Use(Compress())
+	large := strings.Repeat("gee ", 512)
+	r.GET("/now", func(c *Context) {
+		c.Status(http.StatusCreated)
+		if c.Writer.Status() != http.StatusCreated {
+			t.Errorf("expected Status 201 before the headers are sent, got %d", c.Writer.Status())
+		}
+		// 提前发出的响应头也要带上压缩的决定
+		c.Writer.WriteHeaderNow()
+		c.Writer.Write([]byte(large))
+	})
+
+	req := httptest.NewRequest("GET", "/now", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+	if enc := w.Header().Get("Content-Encoding"); enc != "" || w.Body.String() != large {
+		t.Errorf("headers sent before the body must not switch to %q", enc)
+	}
+}
+
+func TestCompressPanic(t *testing.T) {
+	r := New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{Output: io.Discard}), Compress())
+	large := strings.Repeat("gee ", 512)
+	r.GET("/buffered", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+	r.GET("/started", func(c *Context) {
+		c.String(http.StatusOK, large)
+		panic("boom")
+	})
+
+	// 还在缓冲区里的部分响应被丢弃, Recovery 回复 500
+	req := httptest.NewRequest("GET", "/buffered", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("expected a clean 500, got %d %q", w.Code, w.Body.String())
+	}
+	if enc := w.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("the 500 should not be marked %q", enc)
+	}
+
+	// 已经开始的压缩流不写结尾, 客户端能看出响应被截断
+	req = httptest.NewRequest("GET", "/started", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(zr); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected a truncated gzip stream, got %v", err)
+	}
+}
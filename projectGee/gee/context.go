@@ -1,26 +1,42 @@
 package gee
 
 import (
-	"encoding/json"
+	"bufio"
+	"errors"
 	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 )
 
 type H map[string]interface{}
 
 type Context struct {
 	// origin objects
-	Writer http.ResponseWriter
+	Writer ResponseWriter
 	Req    *http.Request
+	writer responseWriter // Writer of the request, reused with the Context
 	// request info
 	Path   string
 	Method string
 	Params map[string]string
-	// response info
+	params []param // reused by the router on lookup
+	// set by the RequestID middleware
+	requestID string
+	// response info, the status set through the Context.
+	// Writer.Status() reports the status actually sent.
 	StatusCode int
 	// middleware
 	handlers []HandlerFunc
 	index    int
+	// errors reported through c.Error
+	Errors Errors
+	// request scoped values, allocated on the first Set
+	mu   sync.RWMutex
+	Keys map[string]interface{}
 	// engine pointer
 	engine *Engine
 }
@@ -30,14 +46,191 @@ func (c *Context) Param(key string) string {
 	return value
 }
 
-func newContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		Writer: w,
-		Req:    r,
-		Path:   r.URL.Path,
-		Method: r.Method,
-		index:  -1,
+// Set stores value under key for the rest of the request,
+// e.g. an auth middleware passing the user on to the handlers
+func (c *Context) Set(key string, value interface{}) {
+	c.mu.Lock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]interface{})
 	}
+	c.Keys[key] = value
+	c.mu.Unlock()
+}
+
+// Get returns the value stored under key and whether it exists
+func (c *Context) Get(key string) (value interface{}, exists bool) {
+	c.mu.RLock()
+	value, exists = c.Keys[key]
+	c.mu.RUnlock()
+	return
+}
+
+// MustGet returns the value stored under key and panics if it does not exist
+func (c *Context) MustGet(key string) interface{} {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic("gee: key \"" + key + "\" does not exist")
+}
+
+// Value returns the value stored under key as a T. ok is false when the
+// key does not exist or holds another type.
+//
+//	user, ok := gee.Value[*User](c, "user")
+func Value[T any](c *Context, key string) (value T, ok bool) {
+	v, exists := c.Get(key)
+	if !exists {
+		return
+	}
+	value, ok = v.(T)
+	return
+}
+
+// typed getters return the zero value when the key is missing or holds another type
+
+func (c *Context) GetString(key string) string {
+	value, _ := Value[string](c, key)
+	return value
+}
+
+func (c *Context) GetBool(key string) bool {
+	value, _ := Value[bool](c, key)
+	return value
+}
+
+func (c *Context) GetInt(key string) int {
+	value, _ := Value[int](c, key)
+	return value
+}
+
+func (c *Context) GetInt64(key string) int64 {
+	value, _ := Value[int64](c, key)
+	return value
+}
+
+func (c *Context) GetFloat64(key string) float64 {
+	value, _ := Value[float64](c, key)
+	return value
+}
+
+func (c *Context) GetDuration(key string) time.Duration {
+	value, _ := Value[time.Duration](c, key)
+	return value
+}
+
+func (c *Context) GetTime(key string) time.Time {
+	value, _ := Value[time.Time](c, key)
+	return value
+}
+
+func (c *Context) GetStringSlice(key string) []string {
+	value, _ := Value[[]string](c, key)
+	return value
+}
+
+/*
+Context 由 Engine 通过 sync.Pool 复用: 请求结束后 Context 会被重置并分配给下一个请求.
+handler 返回之后不能再使用 c 以及 c.Params, 需要在 goroutine 中使用时先调用 c.Copy()
+*/
+
+// reset prepares a pooled context for a new request
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.writer.reset(w)
+	c.Writer = &c.writer
+	c.Req = r
+	c.Path = r.URL.Path
+	c.Method = r.Method
+	for key := range c.Params {
+		delete(c.Params, key)
+	}
+	c.params = c.params[:0]
+	c.StatusCode = 0
+	c.handlers = nil
+	c.index = -1
+	c.Errors = c.Errors[:0]
+	c.Keys = nil
+	c.requestID = ""
+}
+
+// Copy returns a copy of the context that can be safely used outside the
+// request, e.g. handed to a goroutine. The copy keeps the request data but
+// is detached from the response: writing through it panics.
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Writer:     detachedWriter{status: c.Writer.Status(), size: c.Writer.Size()},
+		Req:        c.Req,
+		Path:       c.Path,
+		Method:     c.Method,
+		Params:     make(map[string]string, len(c.Params)),
+		StatusCode: c.StatusCode,
+		index:      abortIndex,
+		Errors:     append(Errors(nil), c.Errors...),
+		engine:     c.engine,
+		requestID:  c.requestID,
+	}
+	for key, value := range c.Params {
+		cp.Params[key] = value
+	}
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]interface{}, len(c.Keys))
+		for key, value := range c.Keys {
+			cp.Keys[key] = value
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
+// detachedWriter is the writer of a copied context, it still reports the
+// status and size of the original response at the time of the copy
+type detachedWriter struct {
+	status int
+	size   int
+}
+
+func (detachedWriter) Header() http.Header {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) Write([]byte) (int, error) {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) WriteHeader(int) {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) WriteHeaderNow() {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) Flush() {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) Push(string, *http.PushOptions) error {
+	panic("gee: response written through a copied Context")
+}
+
+func (detachedWriter) Pusher() http.Pusher {
+	return nil
+}
+
+func (w detachedWriter) Status() int {
+	return w.status
+}
+
+func (w detachedWriter) Size() int {
+	return w.size
+}
+
+func (w detachedWriter) Written() bool {
+	return w.size != noWritten
 }
 
 func (c *Context) Next() {
@@ -48,9 +241,82 @@ func (c *Context) Next() {
 	}
 }
 
-func (c *Context) Fail(code int, err string) {
-	c.index = len(c.handlers)
-	c.JSON(code, H{"message": err})
+// abortIndex 大于任何 handler 链的长度, Next 遇到它就不再继续
+const abortIndex = math.MaxInt >> 1
+
+// Abort stops the remaining handlers from running. Handlers already on
+// the stack, e.g. a middleware waiting on c.Next(), still finish.
+func (c *Context) Abort() {
+	c.index = abortIndex
+}
+
+// IsAborted reports whether the chain was aborted
+func (c *Context) IsAborted() bool {
+	return c.index >= abortIndex
+}
+
+// AbortWithStatus aborts the chain and records code as the response
+// status. The status is only written when the chain has unwound and
+// nothing else wrote a response, so an earlier middleware can still
+// render a body for it.
+func (c *Context) AbortWithStatus(code int) {
+	c.Status(code)
+	c.Abort()
+}
+
+// AbortWithError aborts the chain with code and collects err, see Context.Error
+func (c *Context) AbortWithError(code int, err error) error {
+	c.AbortWithStatus(code)
+	return c.Error(err)
+}
+
+// Error collects err into c.Errors and returns it, it does not stop the chain
+func (c *Context) Error(err error) error {
+	if err == nil {
+		panic("gee: nil error passed to Context.Error")
+	}
+	c.Errors = append(c.Errors, err)
+	return err
+}
+
+// Fail aborts the chain and renders err as JSON. Binding and validation
+// errors list every failed field:
+//
+//	{"message": "validation failed", "errors": [{"field": "Name", "message": "is required"}]}
+//
+// An error caused by a body over the size limit is always rendered as 413.
+// A broken `validate` tag (*RuleError) is a bug of the server: it is
+// collected on the Context and answered with a generic 500.
+func (c *Context) Fail(code int, err interface{}) {
+	c.Abort()
+	var tooLarge *http.MaxBytesError
+	if e, ok := err.(error); ok && errors.As(e, &tooLarge) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	var ruleErr *RuleError
+	if e, ok := err.(error); ok && errors.As(e, &ruleErr) {
+		c.Error(e)
+		c.JSON(http.StatusInternalServerError, H{"message": "Internal Server Error"})
+		return
+	}
+	switch e := err.(type) {
+	case ValidationErrors:
+		fields := make([]H, len(e))
+		for i, fe := range e {
+			fields[i] = H{"field": fe.Field, "rule": fe.Rule, "message": fe.Message}
+		}
+		c.JSON(code, H{"message": "validation failed", "errors": fields})
+	case BindingErrors:
+		fields := make([]H, len(e))
+		for i, be := range e {
+			fields[i] = H{"field": be.Field, "message": be.Err.Error()}
+		}
+		c.JSON(code, H{"message": "binding failed", "errors": fields})
+	case error:
+		c.JSON(code, H{"message": e.Error()})
+	default:
+		c.JSON(code, H{"message": fmt.Sprint(err)})
+	}
 }
 
 func (c *Context) PostForm(key string) string {
@@ -61,6 +327,29 @@ func (c *Context) Query(key string) string {
 	return c.Req.URL.Query().Get(key)
 }
 
+// ClientIP returns the address of the client. The proxy headers are only
+// used when Engine.ForwardedByClientIP is set, they are trivial to forge.
+func (c *Context) ClientIP() string {
+	if c.engine != nil && c.engine.ForwardedByClientIP {
+		if forwarded := c.Req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			ip, _, _ := strings.Cut(forwarded, ",")
+			if ip = strings.TrimSpace(ip); ip != "" {
+				return ip
+			}
+		}
+		if ip := strings.TrimSpace(c.Req.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(c.Req.RemoteAddr)
+	if err != nil {
+		return c.Req.RemoteAddr
+	}
+	return host
+}
+
+// Status sets the response status, the headers are sent with the first
+// write or once the chain has finished
 func (c *Context) Status(code int) {
 	c.StatusCode = code
 	c.Writer.WriteHeader(code)
@@ -71,29 +360,17 @@ func (c *Context) SetHeader(key string, value string) {
 }
 
 func (c *Context) String(code int, format string, values ...interface{}) {
-	c.SetHeader("Content-Type", "text/plain")
-	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(format, values...)))
+	c.Render(code, Text{Format: format, Values: values})
 }
 
 func (c *Context) JSON(code int, obj interface{}) {
-	c.SetHeader("Content-Type", "application/json")
-	c.Status(code)
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(obj); err != nil {
-		http.Error(c.Writer, err.Error(), 500)
-	}
+	c.Render(code, JSON{Data: obj})
 }
 
 func (c *Context) Data(code int, data []byte) {
-	c.Status(code)
-	c.Writer.Write(data)
+	c.Render(code, Bytes{Data: data})
 }
 
 func (c *Context) HTML(code int, name string, data interface{}) {
-	c.SetHeader("Content-Type", "text/html")
-	c.Status(code)
-	if err := c.engine.htmlTemplates.ExecuteTemplate(c.Writer, name, data); err != nil {
-		c.Fail(500, err.Error())
-	}
+	c.Render(code, HTML{Template: c.engine.htmlTemplates, Name: name, Data: data})
 }
@@ -0,0 +1,269 @@
+package gee
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestContextReset(t *testing.T) {
+	r := New()
+	r.GET("/user/:id", func(c *Context) { c.String(http.StatusCreated, c.Param("id")) })
+	r.GET("/plain", func(c *Context) {
+		if len(c.Params) != 0 || c.StatusCode != 0 {
+			t.Errorf("context not reset: params %v, status %d", c.Params, c.StatusCode)
+		}
+		c.String(http.StatusOK, "plain")
+	})
+
+	for i := 0; i < 10; i++ {
+		for _, path := range []string{"/user/1", "/plain"} {
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}
+	}
+}
+
+func TestContextCopy(t *testing.T) {
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	got := make(chan string, 1)
+
+	r := New()
+	r.GET("/user/:id", func(c *Context) {
+		if c.Param("id") != "1" {
+			c.String(http.StatusOK, c.Param("id"))
+			return
+		}
+		cp := c.Copy()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 等到原 Context 被后续请求复用之后再读
+			<-release
+			got <- cp.Param("id") + " " + cp.Path
+		}()
+		c.String(http.StatusOK, "1")
+	})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/1", nil))
+	for i := 2; i < 10; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/user/2", nil))
+	}
+	close(release)
+	wg.Wait()
+
+	if v := <-got; v != "1 /user/1" {
+		t.Fatalf("copied context was corrupted by later requests: %q", v)
+	}
+}
+
+func TestCopiedContextCannotWrite(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("writing through a copied context should panic")
+		}
+	}()
+
+	c := &Context{}
+	c.reset(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.Copy().String(http.StatusOK, "late")
+}
+
+func TestAbort(t *testing.T) {
+	auth := func(c *Context) {
+		if c.Query("token") == "" {
+			c.AbortWithError(http.StatusUnauthorized, errors.New("missing token"))
+			return
+		}
+		c.Next()
+	}
+	called := false
+
+	r := New()
+	admin := r.Group("/admin")
+	admin.Use(auth)
+	admin.GET("/status", func(c *Context) {
+		called = true
+		c.String(http.StatusOK, "ok")
+	})
+	api := r.Group("/api")
+	api.Use(ErrorHandler(), auth)
+	api.GET("/status", func(c *Context) { c.String(http.StatusOK, "ok") })
+	api.GET("/partial", func(c *Context) {
+		c.Writer.Write([]byte("partial"))
+		c.Error(errors.New("late"))
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/admin/status", nil))
+	if called || w.Code != http.StatusUnauthorized || w.Body.Len() != 0 {
+		t.Fatalf("aborted chain should reply 401 without body, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/status", nil))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "missing token") {
+		t.Fatalf("ErrorHandler should render the collected errors, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/status?token=1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("expected 200 ok, got %d %q", w.Code, w.Body.String())
+	}
+
+	// 已经开始写的响应不再追加错误
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/partial?token=1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("expected the partial body alone, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestContextKeys(t *testing.T) {
+	type user struct{ name string }
+
+	r := New()
+	r.Use(func(c *Context) {
+		c.Set("user", &user{"daz"})
+		c.Set("uid", 42)
+		c.Next()
+	})
+	r.GET("/me", func(c *Context) {
+		u, ok := Value[*user](c, "user")
+		if !ok || u.name != "daz" {
+			t.Errorf("expected user daz, got %v", u)
+		}
+		if _, ok := Value[string](c, "uid"); ok {
+			t.Error("Value should fail on a type mismatch")
+		}
+		if c.GetInt("uid") != 42 || c.GetString("uid") != "" || c.GetString("nothing") != "" {
+			t.Error("typed getters returned unexpected values")
+		}
+		if c.MustGet("uid").(int) != 42 {
+			t.Error("MustGet returned an unexpected value")
+		}
+		c.String(http.StatusOK, "ok")
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/me", nil))
+
+	// 复用的 Context 不能带着上一个请求的值
+	r = New()
+	r.GET("/empty", func(c *Context) {
+		if c.Keys != nil {
+			t.Errorf("keys leaked from a previous request: %v", c.Keys)
+		}
+		c.Set("user", "daz")
+	})
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/empty", nil))
+	}
+}
+
+func TestResponseWriter(t *testing.T) {
+	type state struct {
+		status, size int
+		written      bool
+	}
+	var got state
+	r := New()
+	r.Use(func(c *Context) {
+		c.Next()
+		got = state{c.Writer.Status(), c.Writer.Size(), c.Writer.Written()}
+	})
+	r.GET("/direct", func(c *Context) {
+		if c.Writer.Written() || c.Writer.Size() != -1 {
+			t.Error("fresh writer should not be written")
+		}
+		// 绕过 Context 直接写
+		io.WriteString(c.Writer, "hello")
+	})
+	r.GET("/late-header", func(c *Context) {
+		c.Status(http.StatusAccepted)
+		// 状态码只是记录下来, 之后还可以加响应头
+		c.SetHeader("X-Late", "1")
+	})
+	r.GET("/flush", func(c *Context) {
+		c.Status(http.StatusCreated)
+		c.Writer.Flush()
+		c.Status(http.StatusTeapot) // 响应头已经发出, 被忽略
+	})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0o644)
+	r.Static("/assets", dir)
+
+	tests := []struct {
+		path string
+		code int
+		want state
+	}{
+		{"/direct", http.StatusOK, state{http.StatusOK, 5, true}},
+		{"/late-header", http.StatusAccepted, state{http.StatusAccepted, -1, false}},
+		{"/flush", http.StatusCreated, state{http.StatusCreated, 0, true}},
+		{"/assets/app.css", http.StatusOK, state{http.StatusOK, 6, true}},
+		{"/assets/missing.css", http.StatusNotFound, state{http.StatusNotFound, -1, false}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected writer state %+v, got %+v", tt.path, tt.want, got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/late-header", nil))
+	if w.Header().Get("X-Late") != "1" {
+		t.Error("header set after Status was not sent")
+	}
+}
+
+// pushRecorder is a ResponseRecorder of an HTTP/2 connection
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (w *pushRecorder) Push(target string, _ *http.PushOptions) error {
+	w.pushed = append(w.pushed, target)
+	return nil
+}
+
+func TestResponseWriterPush(t *testing.T) {
+	r := New()
+	r.Use(Compress())
+	r.GET("/", func(c *Context) {
+		// 标准库和第三方代码用类型断言找 http.Pusher
+		pusher, ok := c.Writer.(http.Pusher)
+		if !ok {
+			t.Fatal("the writer should implement http.Pusher")
+		}
+		if err := pusher.Push("/app.css", nil); err != nil {
+			t.Errorf("push failed: %v", err)
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if len(w.pushed) != 1 || w.pushed[0] != "/app.css" {
+		t.Errorf("expected /app.css to be pushed, got %v", w.pushed)
+	}
+
+	// HTTP/1 的连接不支持推送
+	r.GET("/http1", func(c *Context) {
+		if err := c.Writer.Push("/app.css", nil); err != http.ErrNotSupported {
+			t.Errorf("expected ErrNotSupported, got %v", err)
+		}
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/http1", nil))
+}
@@ -0,0 +1,214 @@
+package gee
+
+/*
+cookie 工具: 普通 cookie, HMAC 签名的 cookie 以及 AES-GCM 加密的 cookie
+
+	r.CookieSigningKeys = [][]byte{newKey, oldKey} // 第一个 key 用于签名, 所有 key 都可以验证
+	c.SetSignedCookie("uid", "42", nil)
+	uid, err := c.SignedCookie("uid")
+
+签名只能防篡改, 内容仍然可读; 需要保密的内容使用 SetEncryptedCookie.
+*/
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNoCookieKeys is returned when the engine has no key for signing or encryption
+	ErrNoCookieKeys = errors.New("gee: no cookie keys configured")
+	// ErrInvalidCookie is returned for cookies failing verification or decryption
+	ErrInvalidCookie = errors.New("gee: invalid cookie")
+)
+
+// CookieOptions are the attributes of a cookie
+type CookieOptions struct {
+	Path     string // "/" when empty
+	Domain   string
+	MaxAge   int // seconds; 0 makes a session cookie, <0 deletes the cookie
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// defaultCookieOptions is the initial Engine.CookieOptions
+var defaultCookieOptions = CookieOptions{Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+
+func (c *Context) cookieOptions(opts *CookieOptions) CookieOptions {
+	o := defaultCookieOptions
+	if opts != nil {
+		o = *opts
+	} else if c.engine != nil {
+		o = c.engine.CookieOptions
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	return o
+}
+
+// Cookie returns the unescaped value of the named request cookie
+func (c *Context) Cookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// SetCookie adds a Set-Cookie header, escaping value. A nil opts uses
+// Engine.CookieOptions.
+func (c *Context) SetCookie(name string, value string, opts *CookieOptions) {
+	c.setRawCookie(name, url.QueryEscape(value), opts)
+}
+
+// DeleteCookie tells the client to drop the named cookie
+func (c *Context) DeleteCookie(name string, opts *CookieOptions) {
+	o := c.cookieOptions(opts)
+	o.MaxAge = -1
+	c.setRawCookie(name, "", &o)
+}
+
+func (c *Context) setRawCookie(name string, value string, opts *CookieOptions) {
+	o := c.cookieOptions(opts)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		Secure:   o.Secure,
+		HttpOnly: o.HttpOnly,
+		SameSite: o.SameSite,
+	})
+}
+
+func (c *Context) cookieKeys(encryption bool) [][]byte {
+	if c.engine == nil {
+		return nil
+	}
+	if encryption {
+		return c.engine.CookieEncryptionKeys
+	}
+	return c.engine.CookieSigningKeys
+}
+
+// SetSignedCookie sets a cookie whose value is signed with the first key of
+// Engine.CookieSigningKeys. The signature covers the cookie name, so a
+// value cannot be moved to another cookie.
+func (c *Context) SetSignedCookie(name string, value string, opts *CookieOptions) error {
+	keys := c.cookieKeys(false)
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	c.setRawCookie(name, encoded+"."+sign(keys[0], name, encoded), opts)
+	return nil
+}
+
+// SignedCookie returns the value of a cookie set by SetSignedCookie,
+// verifying it against every key of Engine.CookieSigningKeys
+func (c *Context) SignedCookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	keys := c.cookieKeys(false)
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+
+	encoded, mac, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+	for _, key := range keys {
+		if hmac.Equal([]byte(mac), []byte(sign(key, name, encoded))) {
+			value, err := base64.RawURLEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", ErrInvalidCookie
+			}
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+func sign(key []byte, name string, value string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SetEncryptedCookie sets a cookie encrypted with AES-GCM using the first
+// key of Engine.CookieEncryptionKeys. The cookie name is authenticated too.
+func (c *Context) SetEncryptedCookie(name string, value string, opts *CookieOptions) error {
+	keys := c.cookieKeys(true)
+	if len(keys) == 0 {
+		return ErrNoCookieKeys
+	}
+	aead, err := newGCM(keys[0])
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	c.setRawCookie(name, base64.RawURLEncoding.EncodeToString(sealed), opts)
+	return nil
+}
+
+// EncryptedCookie decrypts a cookie set by SetEncryptedCookie, trying every
+// key of Engine.CookieEncryptionKeys
+func (c *Context) EncryptedCookie(name string) (string, error) {
+	cookie, err := c.Req.Cookie(name)
+	if err != nil {
+		return "", err
+	}
+	keys := c.cookieKeys(true)
+	if len(keys) == 0 {
+		return "", ErrNoCookieKeys
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	for _, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return "", ErrInvalidCookie
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, []byte(name)); err == nil {
+			return string(value), nil
+		}
+	}
+	return "", ErrInvalidCookie
+}
+
+// newGCM accepts AES-128, AES-192 and AES-256 keys
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
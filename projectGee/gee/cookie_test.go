@@ -0,0 +1,112 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// cookieRoundTrip sets a cookie through set and reads it back through get
+// on a second request carrying the Set-Cookie value, optionally tampered
+func cookieRoundTrip(t *testing.T, r *Engine, set func(c *Context) error, get func(c *Context) (string, error), tamper func(string) string) (string, error) {
+	c := &Context{engine: r}
+	w := httptest.NewRecorder()
+	c.reset(w, httptest.NewRequest("GET", "/", nil))
+	if err := set(c); err != nil {
+		t.Fatal(err)
+	}
+
+	cookie := w.Result().Cookies()[0]
+	if tamper != nil {
+		cookie.Value = tamper(cookie.Value)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	c.reset(httptest.NewRecorder(), req)
+	return get(c)
+}
+
+func TestCookie(t *testing.T) {
+	r := New()
+	w := httptest.NewRecorder()
+	c := &Context{engine: r}
+	c.reset(w, httptest.NewRequest("GET", "/", nil))
+	c.SetCookie("lang", "zh cn;", nil)
+	c.SetCookie("theme", "dark", &CookieOptions{Path: "/app", MaxAge: 60, Secure: true, SameSite: http.SameSiteStrictMode})
+
+	header := strings.Join(w.Header().Values("Set-Cookie"), "\n")
+	for _, expected := range []string{
+		"lang=zh+cn%3B; Path=/; HttpOnly; SameSite=Lax",
+		"theme=dark; Path=/app; Max-Age=60; Secure; SameSite=Strict",
+	} {
+		if !strings.Contains(header, expected) {
+			t.Errorf("expected %q in %q", expected, header)
+		}
+	}
+
+	value, err := cookieRoundTrip(t, r,
+		func(c *Context) error { c.SetCookie("lang", "zh cn;", nil); return nil },
+		func(c *Context) (string, error) { return c.Cookie("lang") }, nil)
+	if err != nil || value != "zh cn;" {
+		t.Errorf("expected 'zh cn;', got %q %v", value, err)
+	}
+}
+
+func TestSignedCookie(t *testing.T) {
+	r := New()
+	r.CookieSigningKeys = [][]byte{[]byte("old-key")}
+	set := func(c *Context) error { return c.SetSignedCookie("uid", "42", nil) }
+	get := func(c *Context) (string, error) { return c.SignedCookie("uid") }
+
+	if value, err := cookieRoundTrip(t, r, set, get, nil); err != nil || value != "42" {
+		t.Errorf("expected 42, got %q %v", value, err)
+	}
+
+	tamper := func(v string) string { return "NDM" + v[strings.IndexByte(v, '.'):] } // "43"
+	if _, err := cookieRoundTrip(t, r, set, get, tamper); err != ErrInvalidCookie {
+		t.Errorf("tampered cookie should be rejected, got %v", err)
+	}
+
+	// 轮换: 旧 key 签名的 cookie 在新 key 加入之后仍然有效
+	rotate := func(c *Context) (string, error) {
+		r.CookieSigningKeys = [][]byte{[]byte("new-key"), []byte("old-key")}
+		return c.SignedCookie("uid")
+	}
+	if value, err := cookieRoundTrip(t, r, set, rotate, nil); err != nil || value != "42" {
+		t.Errorf("rotated keys should verify old cookies, got %q %v", value, err)
+	}
+	r.CookieSigningKeys = [][]byte{[]byte("new-key")}
+	if _, err := cookieRoundTrip(t, r, set, func(c *Context) (string, error) {
+		r.CookieSigningKeys = [][]byte{[]byte("other-key")}
+		return c.SignedCookie("uid")
+	}, nil); err != ErrInvalidCookie {
+		t.Errorf("retired keys should not verify, got %v", err)
+	}
+}
+
+func TestEncryptedCookie(t *testing.T) {
+	r := New()
+	r.CookieEncryptionKeys = [][]byte{[]byte("0123456789abcdef0123456789abcdef")}
+	set := func(c *Context) error { return c.SetEncryptedCookie("token", "secret", nil) }
+	get := func(c *Context) (string, error) { return c.EncryptedCookie("token") }
+
+	value, err := cookieRoundTrip(t, r, set, get, nil)
+	if err != nil || value != "secret" {
+		t.Errorf("expected secret, got %q %v", value, err)
+	}
+
+	tamper := func(v string) string {
+		b := []byte(v)
+		b[len(b)/2] ^= 'A' ^ 'B'
+		return string(b)
+	}
+	if _, err := cookieRoundTrip(t, r, set, get, tamper); err != ErrInvalidCookie {
+		t.Errorf("tampered cookie should be rejected, got %v", err)
+	}
+
+	r.CookieEncryptionKeys = nil
+	if err := set(&Context{engine: r}); err != ErrNoCookieKeys {
+		t.Errorf("expected ErrNoCookieKeys, got %v", err)
+	}
+}
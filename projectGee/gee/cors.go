@@ -0,0 +1,154 @@
+package gee
+
+/*
+middleware: CORS
+
+	r.Use(gee.CORSWithConfig(gee.CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+预检请求 (带 Access-Control-Request-Method 的 OPTIONS) 由中间件直接应答,
+不需要注册 OPTIONS 路由: 没有匹配路由的请求同样会经过分组的中间件.
+*/
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig configures the CORS middleware
+type CORSConfig struct {
+	// AllowOrigins lists the allowed origins: exact ("https://example.com"),
+	// wildcard subdomains ("https://*.example.com") or "*" for any origin
+	AllowOrigins []string
+	// AllowOriginFunc allows origins in addition to AllowOrigins
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods are the methods allowed in preflight requests,
+	// GET, POST, PUT, PATCH, DELETE and HEAD by default
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed in preflight requests.
+	// When empty the headers asked for by the client are allowed.
+	AllowHeaders []string
+	// ExposeHeaders are the response headers readable by the client
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and HTTP authentication, the allowed
+	// origin is echoed. It cannot be combined with "*", which would let any
+	// site send requests with the user's cookies.
+	AllowCredentials bool
+	// MaxAge is how long the result of a preflight request may be cached
+	MaxAge time.Duration
+}
+
+// CORS allows requests from any origin with the default methods
+func CORS() HandlerFunc {
+	return CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}})
+}
+
+// CORSWithConfig returns a CORS middleware for config
+func CORSWithConfig(config CORSConfig) HandlerFunc {
+	allowAll := false
+	var exact []string
+	var wildcards [][2]string // scheme://*.domain 拆成 "scheme://" 和 ".domain"
+	for _, origin := range config.AllowOrigins {
+		switch {
+		case origin == "*":
+			allowAll = true
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "://*.")
+			wildcards = append(wildcards, [2]string{strings.ToLower(origin[:i+3]), strings.ToLower(origin[i+4:])})
+		default:
+			exact = append(exact, strings.ToLower(origin))
+		}
+	}
+	if allowAll && config.AllowCredentials {
+		panic("gee: CORS AllowOrigins \"*\" cannot be used with AllowCredentials, list the origins or use AllowOriginFunc")
+	}
+
+	allowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		lower := strings.ToLower(origin)
+		for _, o := range exact {
+			if lower == o {
+				return true
+			}
+		}
+		for _, w := range wildcards {
+			if strings.HasPrefix(lower, w[0]) && strings.HasSuffix(lower, w[1]) && len(lower) > len(w[0])+len(w[1]) {
+				return true
+			}
+		}
+		return config.AllowOriginFunc != nil && config.AllowOriginFunc(origin)
+	}
+
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead}
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(config.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.Itoa(int(config.MaxAge / time.Second))
+	}
+
+	return func(c *Context) {
+		origin := c.Req.Header.Get("Origin")
+		header := c.Writer.Header()
+		if !allowAll || origin != "" {
+			// 没有 Origin 的响应也要标记, 否则共享缓存会把它用在跨域请求上
+			header.Add("Vary", "Origin")
+		}
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		preflight := c.Method == http.MethodOptions && c.Req.Header.Get("Access-Control-Request-Method") != ""
+		if !allowed(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			// 不带 CORS 头, 由浏览器拦截响应
+			c.Next()
+			return
+		}
+
+		if allowAll {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				header.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", allowHeaders)
+		} else if requested := c.Req.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			header.Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge != "" {
+			header.Set("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,89 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	r := New()
+	r.Use(CORSWithConfig(CORSConfig{
+		AllowOrigins:     []string{"https://app.example.com", "https://*.example.org"},
+		AllowOriginFunc:  func(origin string) bool { return strings.HasSuffix(origin, ".test") },
+		AllowCredentials: true,
+		ExposeHeaders:    []string{"X-Total"},
+		MaxAge:           time.Hour,
+	}))
+	r.GET("/users", func(c *Context) { c.String(http.StatusOK, "users") })
+
+	tests := []struct {
+		method  string
+		origin  string
+		code    int
+		allowed bool
+	}{
+		{"GET", "https://app.example.com", http.StatusOK, true},
+		{"GET", "https://api.example.org", http.StatusOK, true},
+		{"GET", "https://example.org", http.StatusOK, false},
+		{"GET", "http://api.example.org", http.StatusOK, false},
+		{"GET", "http://local.test", http.StatusOK, true},
+		{"GET", "https://evil.com", http.StatusOK, false},
+		// 没有注册 OPTIONS 路由也能应答预检请求
+		{"OPTIONS", "https://app.example.com", http.StatusNoContent, true},
+		{"OPTIONS", "https://evil.com", http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/users", nil)
+		req.Header.Set("Origin", tt.origin)
+		if tt.method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "PUT")
+			req.Header.Set("Access-Control-Request-Headers", "Authorization")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.code {
+			t.Errorf("%s %s: expected %d, got %d", tt.method, tt.origin, tt.code, w.Code)
+		}
+		if allowed := w.Header().Get("Access-Control-Allow-Origin") == tt.origin; allowed != tt.allowed {
+			t.Errorf("%s %s: expected allowed %v, headers %v", tt.method, tt.origin, tt.allowed, w.Header())
+		}
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/users", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	expected := map[string]string{
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, PATCH, DELETE, HEAD",
+		"Access-Control-Allow-Headers":     "Authorization",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "3600",
+	}
+	for key, value := range expected {
+		if got := w.Header().Get(key); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+
+	// 同一个 URL 的响应随 Origin 变化, 不带 Origin 的请求也一样
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+	if vary := w.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Origin" {
+		t.Errorf("expected Vary Origin without an Origin header, got %q", vary)
+	}
+}
+
+func TestCORSWildcardCredentials(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("AllowOrigins * with AllowCredentials should panic")
+		}
+	}()
+	CORSWithConfig(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
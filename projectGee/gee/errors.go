@@ -0,0 +1,47 @@
+package gee
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Errors is the list of errors collected with Context.Error
+type Errors []error
+
+// Last returns the most recent error, or nil
+func (e Errors) Last() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[len(e)-1]
+}
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ErrorHandler renders the errors collected with c.Error as JSON after the
+// rest of the chain has run, unless a response was already written.
+// The status recorded by AbortWithError is kept, 500 is used otherwise.
+func ErrorHandler() HandlerFunc {
+	return func(c *Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		code := c.StatusCode
+		if code == 0 {
+			code = http.StatusInternalServerError
+		}
+		messages := make([]string, len(c.Errors))
+		for i, err := range c.Errors {
+			messages[i] = err.Error()
+		}
+		c.JSON(code, H{"message": http.StatusText(code), "errors": messages})
+	}
+}
@@ -1,11 +1,17 @@
 package gee
 
 import (
-	//"log"
+	"context"
+	"fmt"
 	"html/template"
+	"log"
 	"net/http"
 	"path"
+	"reflect"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 )
 
 type HandlerFunc func(*Context)
@@ -22,23 +28,142 @@ type (
 	Engine struct {
 		*RouteGroup   // 继承嵌入类型的所有属性与方法
 		router        *router
-		groups        []*RouteGroup      // store all groups
-		htmlTemplates *template.Template // for html render: 将所有模板加载入内存
-		funcMap       template.FuncMap   // for html render: 所有的自定义模板渲染函数
+		groups        []*RouteGroup            // store all groups
+		htmlTemplates *template.Template       // for html render: 将所有模板加载入内存
+		funcMap       template.FuncMap         // for html render: 所有的自定义模板渲染函数
+		pool          sync.Pool                // reuse Context between requests
+		namedRoutes   map[string]*route        // for URLFor
+		renderers     map[string]RenderFactory // for Context.RenderFormat
+
+		// Validator checks structs after binding, DefaultValidator by default
+		Validator Validator
+		// MaxMultipartMemory is the part of a multipart form kept in memory,
+		// the rest is stored in temporary files. 32 MB by default
+		MaxMultipartMemory int64
+		// CookieOptions are used by the cookie helpers when no options are
+		// given: Path "/", HttpOnly and SameSite=Lax by default
+		CookieOptions CookieOptions
+		// CookieSigningKeys are the HMAC keys of signed cookies and
+		// CookieEncryptionKeys the AES keys of encrypted cookies. The first
+		// key signs or encrypts, every key is tried when reading, so keys are
+		// rotated by putting the new key in front of the old ones.
+		CookieSigningKeys    [][]byte
+		CookieEncryptionKeys [][]byte
+		// ForwardedByClientIP makes Context.ClientIP trust the X-Forwarded-For
+		// and X-Real-IP headers. Only enable it behind a proxy setting them.
+		ForwardedByClientIP bool
+
+		// timeouts of the http.Server started by Run, see http.Server
+		ReadTimeout       time.Duration
+		ReadHeaderTimeout time.Duration
+		WriteTimeout      time.Duration
+		IdleTimeout       time.Duration
+		// HandleSignals makes Run shut down gracefully on SIGINT and SIGTERM,
+		// waiting at most ShutdownTimeout (30s by default) for requests
+		HandleSignals   bool
+		ShutdownTimeout time.Duration
+		// ShutdownHookTimeout bounds the OnShutdown hooks when waiting for
+		// requests used up the context given to Shutdown, 5s by default
+		ShutdownHookTimeout time.Duration
+		// WebSocket configures Context.Upgrade
+		WebSocket WebSocketConfig
+		// StreamHeartbeat is how long an event stream written by
+		// Context.Stream may stay idle before a comment is sent to keep
+		// proxies from closing it. 15s by default, 0 disables it.
+		StreamHeartbeat time.Duration
+
+		serverMu      sync.Mutex
+		running       *runningServer // set while Run is serving
+		startHooks    []func() error
+		shutdownHooks []func(ctx context.Context) error
+		hijacked      connRegistry // connections taken over, closed by Shutdown
+	}
+
+	// Route is returned by the registration methods, e.g. for naming:
+	// r.GET("/user/:id", show).Name("user.show")
+	Route struct {
+		engine *Engine
+		routes []*route
+	}
+
+	// RouteInfo describes a registered route, see Engine.Routes
+	RouteInfo struct {
+		Method      string
+		Pattern     string // full pattern including the group prefix
+		Handler     string // name of the handler function
+		Middlewares int    // number of group and engine middleware running before the handler
+		Group       string // prefix of the group the route was registered on
+		Name        string // set by Route.Name
 	}
 )
 
 func New() *Engine {
 	//return &Engine{router: newRouter()}
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{
+		router:             newRouter(),
+		namedRoutes:        make(map[string]*route),
+		renderers:          defaultRenderers(),
+		Validator:          DefaultValidator,
+		MaxMultipartMemory: defaultMultipartMemory,
+		CookieOptions:      defaultCookieOptions,
+		StreamHeartbeat:    defaultStreamHeartbeat,
+	}
+	engine.funcMap = engine.defaultFuncMap()
 	engine.RouteGroup = &RouteGroup{engine: engine}
 	engine.groups = []*RouteGroup{engine.RouteGroup}
+	engine.pool.New = func() interface{} {
+		return &Context{engine: engine, writer: responseWriter{conns: &engine.hijacked}}
+	}
 
 	return engine
 }
 
+// defaultFuncMap holds the template functions every engine provides:
+// {{urlFor "user.show" "id" .ID}}
+func (engine *Engine) defaultFuncMap() template.FuncMap {
+	return template.FuncMap{
+		"urlFor": func(name string, pairs ...interface{}) (string, error) {
+			if len(pairs)%2 != 0 {
+				return "", fmt.Errorf("gee: urlFor %q needs key/value pairs", name)
+			}
+			params := make(map[string]string, len(pairs)/2)
+			for i := 0; i < len(pairs); i += 2 {
+				params[fmt.Sprint(pairs[i])] = fmt.Sprint(pairs[i+1])
+			}
+			return engine.URLFor(name, params)
+		},
+	}
+}
+
+// SetFuncMap adds custom template functions on top of the default ones
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
-	engine.funcMap = funcMap
+	engine.funcMap = engine.defaultFuncMap()
+	for name, fn := range funcMap {
+		engine.funcMap[name] = fn
+	}
+}
+
+// Name registers the route under name for Engine.URLFor
+func (r *Route) Name(name string) *Route {
+	for _, rt := range r.routes {
+		if other, ok := r.engine.namedRoutes[name]; ok && other.pattern != rt.pattern {
+			panic(fmt.Sprintf("gee: route name %q already used by %s", name, other.pattern))
+		}
+		rt.name = name
+		r.engine.namedRoutes[name] = rt
+	}
+	return r
+}
+
+// URLFor builds the path of the route registered under name. Wildcards are
+// filled from params and escaped, params the pattern does not use are
+// appended as the query string.
+func (engine *Engine) URLFor(name string, params map[string]string) (string, error) {
+	rt, ok := engine.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("gee: no route named %q", name)
+	}
+	return buildURL(rt.pattern, params)
 }
 
 func (engine *Engine) LoadHTMLGlob(pattern string) {
@@ -56,22 +181,108 @@ func (group *RouteGroup) Group(prefix string) *RouteGroup {
 	return newGroup
 }
 
-func (group *RouteGroup) addRoute(method string, comp string, handler HandlerFunc) {
+func (group *RouteGroup) addRoute(method string, comp string, handler HandlerFunc) *route {
 	pattern := group.prefix + comp
-	//log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	rt := group.engine.router.addRoute(method, pattern, handler)
+	rt.group = group
+	group.engine.compile(rt)
+	return rt
+}
+
+func (group *RouteGroup) newRoute(routes ...*route) *Route {
+	return &Route{engine: group.engine, routes: routes}
+}
+
+// anyMethods are the methods registered by RouteGroup.Any
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// Handle registers a handler for an arbitrary HTTP method
+func (group *RouteGroup) Handle(method string, pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute(strings.ToUpper(method), pattern, handler))
+}
+
+func (group *RouteGroup) GET(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("GET", pattern, handler))
+}
+
+func (group *RouteGroup) POST(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("POST", pattern, handler))
+}
+
+func (group *RouteGroup) PUT(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("PUT", pattern, handler))
+}
+
+func (group *RouteGroup) PATCH(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("PATCH", pattern, handler))
+}
+
+func (group *RouteGroup) DELETE(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("DELETE", pattern, handler))
 }
 
-func (group *RouteGroup) GET(pattern string, handler HandlerFunc) {
-	group.addRoute("GET", pattern, handler)
+func (group *RouteGroup) HEAD(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("HEAD", pattern, handler))
 }
 
-func (group *RouteGroup) POST(pattern string, handler HandlerFunc) {
-	group.addRoute("POST", pattern, handler)
+func (group *RouteGroup) OPTIONS(pattern string, handler HandlerFunc) *Route {
+	return group.newRoute(group.addRoute("OPTIONS", pattern, handler))
 }
 
+// Any registers the handler for all common HTTP methods
+func (group *RouteGroup) Any(pattern string, handler HandlerFunc) *Route {
+	routes := make([]*route, 0, len(anyMethods))
+	for _, method := range anyMethods {
+		routes = append(routes, group.addRoute(method, pattern, handler))
+	}
+	return group.newRoute(routes...)
+}
+
+// Use adds middleware to the group. Routes registered before the call
+// are recompiled, so the order of Use and route registration does not matter.
 func (group *RouteGroup) Use(middleware ...HandlerFunc) {
 	group.middlewares = append(group.middlewares, middleware...)
+	for _, rt := range group.engine.router.routes {
+		if hasPathPrefix(rt.pattern, group.prefix) {
+			group.engine.compile(rt)
+		}
+	}
+}
+
+// hasPathPrefix reports whether prefix matches path on a segment boundary:
+// "/v1" matches "/v1" and "/v1/users" but not "/v10/users"
+func hasPathPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || prefix == "" || prefix[len(prefix)-1] == '/' || path[len(prefix)] == '/'
+}
+
+// compile resolves the final handler chain of rt
+func (engine *Engine) compile(rt *route) {
+	handlers := engine.middlewaresFor(rt.pattern)
+	if rt.bodyLimit > 0 {
+		handlers = append(handlers, BodyLimit(rt.bodyLimit))
+	}
+	rt.handlers = append(handlers, rt.handler)
+}
+
+// middlewaresFor collects, in group creation order, the middleware of every
+// group whose prefix matches path. Routes resolve it once on registration;
+// requests without a route (404, 405 and automatic OPTIONS) resolve it
+// against the request path, so they see the same middleware a route
+// registered at that path would.
+func (engine *Engine) middlewaresFor(path string) []HandlerFunc {
+	var middlewares []HandlerFunc
+	for _, group := range engine.groups {
+		if hasPathPrefix(path, group.prefix) {
+			middlewares = append(middlewares, group.middlewares...)
+		}
+	}
+	return middlewares
 }
 
 // create static handler
@@ -94,24 +305,45 @@ func (group *RouteGroup) createStaticHandler(relativePath string, fs http.FileSy
 // r.Static("/assets", "/usr/daz/blog/static")
 func (group *RouteGroup) Static(relativePath string, root string) {
 	handler := group.createStaticHandler(relativePath, http.Dir(root))
-	urlPattern := path.Join(relativePath, "*/filepath")
+	urlPattern := path.Join(relativePath, "/*filepath")
 	// Register GET handlers
 	group.GET(urlPattern, handler)
 }
 
-func (engine *Engine) RUN(addr string) (err error) {
-	return http.ListenAndServe(addr, engine)
+// Routes returns the registered routes in registration order
+func (engine *Engine) Routes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(engine.router.routes))
+	for _, rt := range engine.router.routes {
+		routes = append(routes, RouteInfo{
+			Method:      rt.method,
+			Pattern:     rt.pattern,
+			Handler:     nameOfFunction(rt.handler),
+			Middlewares: len(engine.middlewaresFor(rt.pattern)),
+			Group:       rt.group.prefix,
+			Name:        rt.name,
+		})
+	}
+	return routes
 }
 
-func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	var middlewares []HandlerFunc
-	for _, group := range engine.groups {
-		if strings.HasPrefix(req.URL.Path, group.prefix) {
-			middlewares = append(middlewares, group.middlewares...)
-		}
+func nameOfFunction(f interface{}) string {
+	v := reflect.ValueOf(f)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	return runtime.FuncForPC(v.Pointer()).Name()
+}
+
+// printRoutes 在 debug 模式下启动时打印路由表
+func (engine *Engine) printRoutes() {
+	for _, info := range engine.Routes() {
+		log.Printf("Route %-7s - %-30s --> %s (%d middlewares)", info.Method, info.Pattern, info.Handler, info.Middlewares)
 	}
-	c := newContext(w, req)
-	c.handlers = middlewares
-	c.engine = engine
+}
+
+func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	c := engine.pool.Get().(*Context)
+	c.reset(w, req)
 	engine.router.handle(c)
+	engine.pool.Put(c)
 }
@@ -1,22 +1,172 @@
 package gee
 
 /*
-middleware
+middleware: access log
+
+	r.Use(gee.LoggerWithConfig(gee.LoggerConfig{
+		Format:    gee.LogJSON,
+		SkipPaths: []string{"/healthz"},
+	}))
+
+文本和 JSON 格式通过 log/slog 输出, 也可以传入已有的 *slog.Logger;
+LogCombined 输出 Apache/Nginx 的 combined 格式, 方便沿用现有的日志解析.
 */
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
-// type HandlerFunc func(*Context)
+// LogFormat selects the output format of LoggerWithConfig
+type LogFormat int
+
+const (
+	// LogText writes slog key=value lines
+	LogText LogFormat = iota
+	// LogJSON writes one slog JSON object per request
+	LogJSON
+	// LogCombined writes the Apache/Nginx combined log format
+	LogCombined
+)
+
+// LoggerConfig configures the access log
+type LoggerConfig struct {
+	Format LogFormat
+	// Output is where entries are written, os.Stderr by default
+	Output io.Writer
+	// Logger receives the text and JSON entries instead of Output, so the
+	// access log can share the handler of the application log
+	Logger *slog.Logger
+	// SkipPaths are request paths not logged, e.g. health checks
+	SkipPaths []string
+	// Skip drops the entry of a request when it returns true
+	Skip func(c *Context) bool
+}
+
+// Logger logs every request in the text format to os.Stderr
 func Logger() HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{})
+}
+
+// LoggerWithConfig returns an access log middleware for config.
+// Entries are logged at level INFO, WARN for 4xx and ERROR for 5xx responses.
+func LoggerWithConfig(config LoggerConfig) HandlerFunc {
+	if config.Output == nil {
+		config.Output = os.Stderr
+	}
+	skip := make(map[string]bool, len(config.SkipPaths))
+	for _, p := range config.SkipPaths {
+		skip[p] = true
+	}
+
+	var write func(c *Context, start time.Time, latency time.Duration)
+	if config.Format == LogCombined {
+		var mu sync.Mutex
+		write = func(c *Context, start time.Time, latency time.Duration) {
+			line := combinedLine(c, start)
+			mu.Lock()
+			io.WriteString(config.Output, line)
+			mu.Unlock()
+		}
+	} else {
+		logger := config.Logger
+		if logger == nil {
+			if config.Format == LogJSON {
+				logger = slog.New(slog.NewJSONHandler(config.Output, nil))
+			} else {
+				logger = slog.New(slog.NewTextHandler(config.Output, nil))
+			}
+		}
+		write = func(c *Context, start time.Time, latency time.Duration) {
+			logger.LogAttrs(context.Background(), logLevel(c.Writer.Status()), "request", logAttrs(c, latency)...)
+		}
+	}
+
 	return func(c *Context) {
-		// start timer
-		t := time.Now()
-		// process request
+		if skip[c.Path] {
+			c.Next()
+			return
+		}
+		start := time.Now()
 		c.Next()
-		// calculate resolution time
-		log.Printf("[%d] %s in %v", c.StatusCode, c.Req.RequestURI, time.Since(t))
+		if config.Skip != nil && config.Skip(c) {
+			return
+		}
+		write(c, start, time.Since(start))
+	}
+}
+
+func logLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+func logAttrs(c *Context, latency time.Duration) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("status", c.Writer.Status()),
+		slog.String("method", c.Method),
+		slog.String("path", c.Req.URL.RequestURI()),
+		slog.String("client_ip", c.ClientIP()),
+		slog.String("user_agent", c.Req.UserAgent()),
+		slog.Int("bytes", max(c.Writer.Size(), 0)),
+		slog.Duration("latency", latency),
+	}
+	if id := requestID(c); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if len(c.Errors) > 0 {
+		attrs = append(attrs, slog.String("errors", c.Errors.Error()))
+	}
+	return attrs
+}
+
+// requestID returns the ID set by the RequestID middleware, without it
+// the ID sent by the client or proxy
+func requestID(c *Context) string {
+	if c.requestID != "" {
+		return c.requestID
+	}
+	if id := c.Req.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	return ""
+}
+
+// combinedLine formats the Apache combined log format:
+// host ident user [time] "request line" status bytes "referer" "user agent"
+func combinedLine(c *Context, start time.Time) string {
+	user := "-"
+	if name, _, ok := c.Req.BasicAuth(); ok && name != "" {
+		user = url.QueryEscape(name)
+	}
+	size := "-"
+	if n := c.Writer.Size(); n > 0 {
+		size = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s \"%s\" \"%s\"\n",
+		c.ClientIP(), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		c.Method, c.Req.URL.RequestURI(), c.Req.Proto,
+		c.Writer.Status(), size, combinedQuote(c.Req.Referer()), combinedQuote(c.Req.UserAgent()))
+}
+
+var combinedEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+
+// combinedQuote escapes a header for a quoted field, "-" when empty
+func combinedQuote(s string) string {
+	if s == "" {
+		return "-"
 	}
+	return combinedEscaper.Replace(s)
 }
@@ -0,0 +1,60 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(LoggerWithConfig(LoggerConfig{Format: LogJSON, Output: &out, SkipPaths: []string{"/healthz"}}))
+	r.GET("/users/:id", func(c *Context) { c.Writer.Write([]byte("daz")) })
+	r.GET("/healthz", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	req := httptest.NewRequest("GET", "/users/1?full=1", nil)
+	req.Header.Set("User-Agent", "gee-test")
+	req.Header.Set("X-Request-ID", "abc")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nothing", nil))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 entries, got %q", out.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"level": "INFO", "msg": "request", "status": 200.0, "method": "GET", "path": "/users/1?full=1",
+		"client_ip": "192.0.2.1", "user_agent": "gee-test", "bytes": 3.0, "request_id": "abc",
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("%s: expected %v, got %v", key, value, entry[key])
+		}
+	}
+	if !strings.Contains(lines[1], `"level":"WARN"`) || !strings.Contains(lines[1], `"status":404`) {
+		t.Errorf("404 should be logged as a warning, got %s", lines[1])
+	}
+
+	out.Reset()
+	r = New()
+	r.Use(LoggerWithConfig(LoggerConfig{Format: LogCombined, Output: &out}))
+	r.GET("/users/:id", func(c *Context) { c.String(http.StatusOK, "daz") })
+	req = httptest.NewRequest("GET", "/users/1", nil)
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `evil "agent"`)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	line := out.String()
+	prefix, suffix := "192.0.2.1 - - [", `] "GET /users/1 HTTP/1.1" 200 3 "https://example.com/" "evil \"agent\""`+"\n"
+	if !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, suffix) {
+		t.Errorf("unexpected combined log line %q", line)
+	}
+}
@@ -0,0 +1,58 @@
+package gee
+
+import (
+	"log"
+	"os"
+)
+
+// EnvGeeMode is the environment variable read on startup to set the mode
+const EnvGeeMode = "GEE_MODE"
+
+const (
+	// DebugMode prints the route table on startup and includes extra
+	// diagnostics, like stack traces, in responses
+	DebugMode = "debug"
+	// ReleaseMode is the default mode
+	ReleaseMode = "release"
+)
+
+var geeMode = ReleaseMode
+
+func init() {
+	geeMode = envMode(os.Getenv(EnvGeeMode))
+}
+
+// envMode is the mode selected by the environment variable. A typo there
+// must not panic during package init, it falls back to ReleaseMode.
+func envMode(value string) string {
+	switch value {
+	case DebugMode:
+		return DebugMode
+	case ReleaseMode, "":
+		return ReleaseMode
+	}
+	log.Printf("[WARNING] unknown %s %q, using %s mode", EnvGeeMode, value, ReleaseMode)
+	return ReleaseMode
+}
+
+// SetMode sets gee mode, an empty value selects ReleaseMode
+func SetMode(value string) {
+	switch value {
+	case DebugMode:
+		geeMode = DebugMode
+	case ReleaseMode, "":
+		geeMode = ReleaseMode
+	default:
+		panic("gee: unknown mode " + value)
+	}
+}
+
+// Mode returns the current gee mode
+func Mode() string {
+	return geeMode
+}
+
+// IsDebugging reports whether gee runs in DebugMode
+func IsDebugging() bool {
+	return geeMode == DebugMode
+}
@@ -0,0 +1,26 @@
+package gee
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEnvMode(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	tests := map[string]string{"": ReleaseMode, "release": ReleaseMode, "debug": DebugMode, "Debug": ReleaseMode}
+	for value, mode := range tests {
+		if got := envMode(value); got != mode {
+			t.Errorf("%s=%q: expected %s, got %s", EnvGeeMode, value, mode, got)
+		}
+	}
+	// 写错的值只给出警告
+	if !strings.Contains(out.String(), `unknown GEE_MODE "Debug"`) {
+		t.Errorf("expected a warning for the unknown mode, got %q", out.String())
+	}
+}
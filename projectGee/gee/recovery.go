@@ -1,38 +1,143 @@
 package gee
 
+/*
+middleware: recovery
+
+	r.Use(gee.RecoveryWithConfig(gee.RecoveryConfig{
+		Handler: func(c *gee.Context, err interface{}) {
+			c.JSON(http.StatusInternalServerError, gee.H{"message": "oops"})
+		},
+	}))
+
+客户端断开 (broken pipe, connection reset) 引起的 panic 只记录一行日志, 不再写响应;
+http.ErrAbortHandler 会继续向上 panic, 由 net/http 中断连接.
+*/
+
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
-func trace(message string) string {
+// RecoveryFunc renders the response for a recovered panic
+type RecoveryFunc func(c *Context, err interface{})
+
+// RecoveryConfig configures the recovery middleware
+type RecoveryConfig struct {
+	// Output receives the panic and its stack trace, os.Stderr by default
+	Output io.Writer
+	// Handler renders the response, by default a 500 JSON body which
+	// includes the panic and the stack trace in debug mode
+	Handler RecoveryFunc
+}
+
+// stack returns "file:line function" for the callers, skipping skip frames
+func stack(skip int) []string {
 	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:]) // skip first 3 callers
+	n := runtime.Callers(skip+2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var lines []string
+	for {
+		frame, more := frames.Next()
+		lines = append(lines, fmt.Sprintf("%s:%d %s", frame.File, frame.Line, frame.Function))
+		if !more {
+			break
+		}
+	}
+	return lines
+}
 
+func trace(message string, lines []string) string {
 	var str strings.Builder
 	str.WriteString(message + "\nTraceback:")
-	for _, pc := range pcs[:n] {
-		fn := runtime.FuncForPC(pc)
-		file, line := fn.FileLine(pc)
-		str.WriteString(fmt.Sprintf("\n\t%s:%d\n", file, line))
+	for _, line := range lines {
+		str.WriteString("\n\t" + line)
 	}
 	return str.String()
 }
 
-
+// Recovery turns panics into a 500 response and logs them to os.Stderr
 func Recovery() HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{})
+}
+
+// RecoveryWithConfig returns a recovery middleware for config
+func RecoveryWithConfig(config RecoveryConfig) HandlerFunc {
+	if config.Output == nil {
+		config.Output = os.Stderr
+	}
+	logger := log.New(config.Output, "", log.LstdFlags)
+
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
-				c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
 			}
+			if err == http.ErrAbortHandler {
+				// net/http 用它中断响应, 交回给 server 处理
+				panic(err)
+			}
+
+			message := fmt.Sprintf("%s", err)
+			if id := requestID(c); id != "" {
+				message = fmt.Sprintf("[request_id=%s] %s", id, message)
+			}
+			if brokenPipe(err) {
+				// 客户端已经断开, 不用再写响应
+				logger.Printf("%s %s: client disconnected: %s", c.Method, c.Path, message)
+				if e, ok := err.(error); ok {
+					c.Error(e)
+				}
+				c.Abort()
+				return
+			}
+
+			lines := stack(2)
+			logger.Printf("%s\n\n", trace(message, lines))
+			if config.Handler != nil {
+				config.Handler(c, err)
+			} else {
+				recoveryResponse(c, err, lines)
+			}
+			c.Abort()
 		}()
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// recoveryResponse is the default response, the stack is only shown in debug mode
+func recoveryResponse(c *Context, err interface{}, lines []string) {
+	if c.Writer.Written() {
+		// 响应已经开始发送, 只能中止
+		return
+	}
+	if IsDebugging() {
+		c.JSON(http.StatusInternalServerError, H{
+			"message": "Internal Server Error",
+			"panic":   fmt.Sprint(err),
+			"stack":   lines,
+		})
+		return
+	}
+	c.Fail(http.StatusInternalServerError, "Internal Server Error")
+}
+
+// brokenPipe reports whether err comes from writing to a closed connection.
+// Only the error values count, a message merely saying "broken pipe" does not.
+func brokenPipe(err interface{}) bool {
+	e, ok := err.(error)
+	if !ok {
+		return false
+	}
+	return errors.Is(e, syscall.EPIPE) || errors.Is(e, syscall.ECONNRESET) || errors.Is(e, net.ErrClosed)
+}
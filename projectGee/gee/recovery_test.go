@@ -0,0 +1,98 @@
+package gee
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	var out bytes.Buffer
+	r := New()
+	r.Use(RequestID(), RecoveryWithConfig(RecoveryConfig{Output: &out}))
+	r.GET("/panic", func(c *Context) { panic("boom") })
+	r.GET("/written", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+	r.GET("/pipe", func(c *Context) {
+		panic(&net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)})
+	})
+	r.GET("/closed", func(c *Context) {
+		panic(&net.OpError{Op: "write", Net: "tcp", Err: net.ErrClosed})
+	})
+	r.GET("/lookalike", func(c *Context) { panic(errors.New("upstream said: broken pipe")) })
+	r.GET("/abort", func(c *Context) { panic(http.ErrAbortHandler) })
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		out.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := serve("/panic")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "stack") {
+		t.Errorf("release mode: expected a plain 500, got %d %s", w.Code, w.Body.String())
+	}
+	id := w.Header().Get("X-Request-ID")
+	if !strings.Contains(out.String(), "[request_id="+id+"] boom") || !strings.Contains(out.String(), "Traceback:") {
+		t.Errorf("panic log lacks the request ID or the trace: %s", out.String())
+	}
+
+	mode := Mode()
+	SetMode(DebugMode)
+	w = serve("/panic")
+	SetMode(mode)
+	var body struct {
+		Panic string
+		Stack []string
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Panic != "boom" || len(body.Stack) == 0 || !strings.Contains(body.Stack[0], "recovery_test.go") {
+		t.Errorf("debug mode: expected the panic and its stack, got %s", w.Body.String())
+	}
+
+	if w = serve("/written"); w.Body.String() != "partial" {
+		t.Errorf("nothing should be appended to a written response, got %q", w.Body.String())
+	}
+
+	if w = serve("/pipe"); w.Body.Len() != 0 || strings.Contains(out.String(), "Traceback:") {
+		t.Errorf("broken pipe: expected no body and no trace, got %q, log %s", w.Body.String(), out.String())
+	}
+	if w = serve("/closed"); w.Body.Len() != 0 || strings.Contains(out.String(), "Traceback:") {
+		t.Errorf("closed connection: expected no body and no trace, got %q, log %s", w.Body.String(), out.String())
+	}
+	// 只看错误值, 不看错误信息的文字
+	if w = serve("/lookalike"); w.Code != http.StatusInternalServerError || !strings.Contains(out.String(), "Traceback:") {
+		t.Errorf("an error only mentioning a broken pipe is a panic, got %d, log %s", w.Code, out.String())
+	}
+
+	func() {
+		defer func() {
+			if recover() != http.ErrAbortHandler {
+				t.Error("http.ErrAbortHandler should be re-panicked")
+			}
+		}()
+		serve("/abort")
+	}()
+
+	r = New()
+	r.Use(RecoveryWithConfig(RecoveryConfig{Output: io.Discard, Handler: func(c *Context, err interface{}) {
+		c.String(http.StatusServiceUnavailable, "custom %v", err)
+	}}))
+	r.GET("/panic", func(c *Context) { panic("boom") })
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Body.String() != "custom boom" {
+		t.Errorf("custom handler: got %d %q", w.Code, w.Body.String())
+	}
+}
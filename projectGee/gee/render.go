@@ -0,0 +1,334 @@
+package gee
+
+/*
+响应渲染
+
+	c.Render(http.StatusOK, gee.XML{Data: user})
+	c.YAML(http.StatusOK, config)
+
+	// 注册自定义格式, 例如 msgpack
+	r.RegisterRenderer("msgpack", func(data interface{}) gee.Render { return MsgPack{data} })
+	c.RenderFormat(http.StatusOK, "msgpack", user)
+
+响应体先编码到缓冲区, 成功之后才写响应头: 编码失败时返回 500, 不会在已经发出的响应后面再写一次.
+错误只记录在 c.Errors 里, 客户端只收到通用的错误信息.
+Bytes (c.Data) 本身不会编码失败, 直接写出.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Render encodes a response body
+type Render interface {
+	// ContentType is set as the Content-Type header, unless it is empty
+	ContentType() string
+	Render(w io.Writer) error
+}
+
+// RenderFactory makes the Render of a format for data, see RegisterRenderer
+type RenderFactory func(data interface{}) Render
+
+// defaultRenderers are the formats every engine knows for RenderFormat
+func defaultRenderers() map[string]RenderFactory {
+	return map[string]RenderFactory{
+		"json":          func(data interface{}) Render { return JSON{Data: data} },
+		"indented_json": func(data interface{}) Render { return IndentedJSON{Data: data} },
+		"secure_json":   func(data interface{}) Render { return SecureJSON{Data: data} },
+		"pure_json":     func(data interface{}) Render { return PureJSON{Data: data} },
+		"xml":           func(data interface{}) Render { return XML{Data: data} },
+		"yaml":          func(data interface{}) Render { return YAML{Data: data} },
+	}
+}
+
+// RegisterRenderer makes a format available to Context.RenderFormat,
+// replacing a built-in one of the same name
+func (engine *Engine) RegisterRenderer(name string, factory RenderFactory) {
+	engine.renderers[name] = factory
+}
+
+var renderBufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// maxPooledBuffer 以上的缓冲区用完就丢掉, 一次很大的响应不会一直占着内存
+const maxPooledBuffer = 64 << 10
+
+// Render encodes r and writes it with status code. An encoding error is
+// collected on the Context and answered with a generic 500 instead, or
+// 400 for ErrInvalidCallback.
+func (c *Context) Render(code int, r Render) {
+	if b, ok := r.(Bytes); ok {
+		// 已经编码好的数据不会出错, 直接写, 省掉一次复制
+		c.writeRendered(code, b.ContentType(), b.Data)
+		return
+	}
+
+	buf := renderBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			renderBufferPool.Put(buf)
+		}
+	}()
+
+	if err := r.Render(buf); err != nil {
+		c.Error(err)
+		if errors.Is(err, ErrInvalidCallback) {
+			c.Fail(http.StatusBadRequest, "invalid JSONP callback")
+			return
+		}
+		c.Fail(http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.writeRendered(code, r.ContentType(), buf.Bytes())
+}
+
+func (c *Context) writeRendered(code int, contentType string, body []byte) {
+	if contentType != "" {
+		c.SetHeader("Content-Type", contentType)
+	}
+	c.Status(code)
+	if !bodyAllowed(code) {
+		return
+	}
+	c.Writer.Write(body)
+}
+
+// RenderFormat renders data in a format registered with RegisterRenderer.
+// The format often comes from the request, an unknown one is answered
+// with 406 Not Acceptable.
+func (c *Context) RenderFormat(code int, format string, data interface{}) {
+	factory, ok := c.engine.renderers[format]
+	if !ok {
+		c.Error(fmt.Errorf("gee: unknown render format %q", format))
+		c.Fail(http.StatusNotAcceptable, "unsupported format")
+		return
+	}
+	c.Render(code, factory(data))
+}
+
+// bodyAllowed reports whether a response with status may have a body
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func (c *Context) IndentedJSON(code int, obj interface{}) {
+	c.Render(code, IndentedJSON{Data: obj})
+}
+
+// SecureJSON prefixes JSON arrays with "while(1);" against JSON hijacking
+func (c *Context) SecureJSON(code int, obj interface{}) {
+	c.Render(code, SecureJSON{Data: obj})
+}
+
+// PureJSON does not escape <, > and & in strings
+func (c *Context) PureJSON(code int, obj interface{}) {
+	c.Render(code, PureJSON{Data: obj})
+}
+
+// JSONP wraps the JSON in the function named by the callback query
+// parameter, plain JSON is sent without it
+func (c *Context) JSONP(code int, obj interface{}) {
+	c.Render(code, JSONP{Callback: c.Query("callback"), Data: obj})
+}
+
+func (c *Context) XML(code int, obj interface{}) {
+	c.Render(code, XML{Data: obj})
+}
+
+func (c *Context) YAML(code int, obj interface{}) {
+	c.Render(code, YAML{Data: obj})
+}
+
+// JSON renders Data with encoding/json
+type JSON struct {
+	Data interface{}
+}
+
+func (JSON) ContentType() string { return "application/json" }
+
+func (r JSON) Render(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r.Data)
+}
+
+// IndentedJSON renders Data as indented, human readable JSON
+type IndentedJSON struct {
+	Data interface{}
+}
+
+func (IndentedJSON) ContentType() string { return "application/json" }
+
+func (r IndentedJSON) Render(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(r.Data)
+}
+
+// SecureJSON renders Data as JSON, arrays prefixed with Prefix
+// ("while(1);" when empty) so they cannot be loaded as a script
+type SecureJSON struct {
+	Prefix string
+	Data   interface{}
+}
+
+func (SecureJSON) ContentType() string { return "application/json" }
+
+func (r SecureJSON) Render(w io.Writer) error {
+	b, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && b[0] == '[' {
+		prefix := r.Prefix
+		if prefix == "" {
+			prefix = "while(1);"
+		}
+		if _, err := io.WriteString(w, prefix); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// PureJSON renders Data as JSON without escaping HTML characters
+type PureJSON struct {
+	Data interface{}
+}
+
+func (PureJSON) ContentType() string { return "application/json" }
+
+func (r PureJSON) Render(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(r.Data)
+}
+
+// ErrInvalidCallback is returned by JSONP for a callback that is not a
+// JavaScript identifier
+var ErrInvalidCallback = errors.New("gee: invalid JSONP callback")
+
+// jsonpCallback only allows JavaScript identifiers, e.g. "cb" or "app.onData"
+var jsonpCallback = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// JSONP renders Data as a call of Callback, as plain JSON when Callback is empty
+type JSONP struct {
+	Callback string
+	Data     interface{}
+}
+
+func (r JSONP) ContentType() string {
+	if r.Callback == "" {
+		return "application/json"
+	}
+	return "application/javascript"
+}
+
+func (r JSONP) Render(w io.Writer) error {
+	if r.Callback == "" {
+		return JSON{Data: r.Data}.Render(w)
+	}
+	if !jsonpCallback.MatchString(r.Callback) {
+		// 不回显 callback, 错误信息可能被写进响应
+		return ErrInvalidCallback
+	}
+	b, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	// 开头的注释防止 Rosetta Flash 一类的攻击
+	_, err = fmt.Fprintf(w, "/**/ typeof %s === 'function' && %s(%s);", r.Callback, r.Callback, b)
+	return err
+}
+
+// XML renders Data with encoding/xml, an H becomes a <map> element
+type XML struct {
+	Data interface{}
+}
+
+func (XML) ContentType() string { return "application/xml" }
+
+func (r XML) Render(w io.Writer) error {
+	return xml.NewEncoder(w).Encode(r.Data)
+}
+
+// MarshalXML encodes h as a <map> element with one child per key, in key order
+func (h H) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: "map"}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := e.EncodeElement(h[key], xml.StartElement{Name: xml.Name{Local: key}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// YAML renders Data as a YAML document, see encodeYAML
+type YAML struct {
+	Data interface{}
+}
+
+func (YAML) ContentType() string { return "application/yaml" }
+
+func (r YAML) Render(w io.Writer) error {
+	return encodeYAML(w, r.Data)
+}
+
+// Text renders Format with fmt.Sprintf
+type Text struct {
+	Format string
+	Values []interface{}
+}
+
+func (Text) ContentType() string { return "text/plain" }
+
+func (r Text) Render(w io.Writer) error {
+	_, err := fmt.Fprintf(w, r.Format, r.Values...)
+	return err
+}
+
+// Bytes renders Data as is with an optional content type
+type Bytes struct {
+	Type string
+	Data []byte
+}
+
+func (r Bytes) ContentType() string { return r.Type }
+
+func (r Bytes) Render(w io.Writer) error {
+	_, err := w.Write(r.Data)
+	return err
+}
+
+// HTML renders the template Name of Template
+type HTML struct {
+	Template *template.Template
+	Name     string
+	Data     interface{}
+}
+
+func (HTML) ContentType() string { return "text/html" }
+
+func (r HTML) Render(w io.Writer) error {
+	if r.Template == nil {
+		return errors.New("gee: no HTML templates loaded")
+	}
+	return r.Template.ExecuteTemplate(w, r.Name, r.Data)
+}
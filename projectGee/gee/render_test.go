@@ -0,0 +1,219 @@
+package gee
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type renderUser struct {
+	Name   string   `yaml:"name"`
+	Tags   []string `yaml:"tags"`
+	Note   string   `yaml:"note,omitempty"`
+	Secret string   `yaml:"-"`
+}
+
+func TestRender(t *testing.T) {
+	r := New()
+	r.GET("/xml", func(c *Context) {
+		c.XML(http.StatusOK, H{"name": "geektutu", "age": 20})
+	})
+	r.GET("/yaml", func(c *Context) {
+		c.YAML(http.StatusOK, H{
+			"users":   []renderUser{{Name: "Tom", Tags: []string{"admin", "true"}, Secret: "x"}},
+			"version": "1.0",
+			"empty":   H{},
+		})
+	})
+	r.GET("/jsonp", func(c *Context) {
+		c.JSONP(http.StatusOK, H{"ok": true})
+	})
+	r.GET("/secure", func(c *Context) {
+		c.SecureJSON(http.StatusOK, []int{1, 2})
+	})
+	r.GET("/pure", func(c *Context) {
+		c.PureJSON(http.StatusOK, H{"html": "<b>"})
+	})
+	r.GET("/indented", func(c *Context) {
+		c.IndentedJSON(http.StatusOK, H{"a": 1})
+	})
+
+	tests := []struct {
+		path, contentType, body string
+	}{
+		{"/xml", "application/xml", "<map><age>20</age><name>geektutu</name></map>"},
+		{"/yaml", "application/yaml", "empty: {}\nusers:\n  - name: Tom\n    tags:\n      - admin\n      - \"true\"\nversion: \"1.0\"\n"},
+		{"/jsonp?callback=app.onData", "application/javascript", "/**/ typeof app.onData === 'function' && app.onData({\"ok\":true});"},
+		{"/jsonp", "application/json", "{\"ok\":true}\n"},
+		{"/secure", "application/json", "while(1);[1,2]"},
+		{"/pure", "application/json", "{\"html\":\"<b>\"}\n"},
+		{"/indented", "application/json", "{\n    \"a\": 1\n}\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", tt.path, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: expected Content-Type %q, got %q", tt.path, tt.contentType, ct)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s: expected body %q, got %q", tt.path, tt.body, w.Body.String())
+		}
+	}
+
+	// 非法的 callback 不会被写进响应
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/jsonp?callback=alert(1)//", nil))
+	if w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "alert") {
+		t.Errorf("invalid callback: expected a clean 400, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	var errs Errors
+	r := New()
+	r.GET("/bad", func(c *Context) {
+		c.JSON(http.StatusOK, H{"f": func() {}})
+		errs = c.Errors
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/bad", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON error body, got Content-Type %q", ct)
+	}
+	if body := w.Body.String(); body != "{\"message\":\"Internal Server Error\"}\n" {
+		t.Errorf("expected a single generic error body, got %q", body)
+	}
+	if len(errs) != 1 {
+		t.Errorf("expected the encoding error on the context, got %v", errs)
+	}
+}
+
+type csvRender struct {
+	rows [][]string
+}
+
+func (csvRender) ContentType() string { return "text/csv" }
+
+func (r csvRender) Render(w io.Writer) error {
+	for _, row := range r.rows {
+		if _, err := io.WriteString(w, strings.Join(row, ",")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRegisterRenderer(t *testing.T) {
+	r := New()
+	r.RegisterRenderer("csv", func(data interface{}) Render {
+		return csvRender{rows: data.([][]string)}
+	})
+	r.GET("/report", func(c *Context) {
+		format := c.Query("format")
+		if format == "" {
+			format = "csv"
+		}
+		c.RenderFormat(http.StatusOK, format, [][]string{{"a", "b"}, {"1", "2"}})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Header().Get("Content-Type") != "text/csv" || w.Body.String() != "a,b\n1,2\n" {
+		t.Errorf("unexpected csv response %q %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/report?format=yaml", nil))
+	if w.Body.String() != "- - a\n  - b\n- - \"1\"\n  - \"2\"\n" {
+		t.Errorf("unexpected yaml response %q", w.Body.String())
+	}
+
+	// 格式来自请求, 不认识的格式回复 406 而不是 panic
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/report?format=bogus", nil))
+	if w.Code != http.StatusNotAcceptable || strings.Contains(w.Body.String(), "bogus") {
+		t.Errorf("unknown format: expected a clean 406, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// sliceRecorder remembers the slices passed to Write
+type sliceRecorder struct {
+	*httptest.ResponseRecorder
+	writes [][]byte
+}
+
+func (w *sliceRecorder) Write(b []byte) (int, error) {
+	w.writes = append(w.writes, b)
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestRenderBuffer(t *testing.T) {
+	payload := []byte(strings.Repeat("x", 1<<20))
+	r := New()
+	r.GET("/data", func(c *Context) {
+		c.Data(http.StatusOK, payload)
+	})
+	r.GET("/big", func(c *Context) {
+		c.JSON(http.StatusOK, H{"payload": string(payload)})
+	})
+
+	// c.Data 的字节不经过缓冲区
+	w := &sliceRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/data", nil))
+	if len(w.writes) != 1 || &w.writes[0][0] != &payload[0] {
+		t.Errorf("Data should be written without a copy, got %d writes", len(w.writes))
+	}
+
+	// 大响应用过的缓冲区不放回池里
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/big", nil))
+	if buf := renderBufferPool.Get().(*bytes.Buffer); buf.Cap() > maxPooledBuffer {
+		t.Errorf("a %d byte buffer was kept in the pool", buf.Cap())
+	}
+}
+
+type yamlNode struct {
+	Name string            `yaml:"name"`
+	Next *yamlNode         `yaml:"next"`
+	Tags []string          `yaml:"tags"`
+	Meta map[string]string `yaml:"meta"`
+}
+
+func TestYAMLEncoder(t *testing.T) {
+	// nil 的 map 和 slice 是 null, 空的才是 {} 和 []
+	var buf bytes.Buffer
+	if err := encodeYAML(&buf, yamlNode{Name: "a", Meta: map[string]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "name: a\nnext: null\ntags: null\nmeta: {}\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+
+	// 同一个值出现两次不是循环引用
+	shared := &yamlNode{Name: "shared"}
+	buf.Reset()
+	if err := encodeYAML(&buf, []*yamlNode{shared, shared}); err != nil {
+		t.Errorf("a value used twice should be encoded, got %v", err)
+	}
+
+	loop := &yamlNode{Name: "loop"}
+	loop.Next = loop
+	m := H{}
+	m["self"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	for _, v := range []interface{}{loop, m, s} {
+		if err := encodeYAML(io.Discard, v); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+			t.Errorf("%T: expected a cycle error, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package gee
+
+/*
+middleware: request ID
+
+	r.Use(gee.RequestID(), gee.Logger(), gee.Recovery())
+
+	client := gee.NewClient(nil)
+	r.GET("/orders", func(c *gee.Context) {
+		// 用请求的 context 发出的调用会带上同一个 X-Request-ID
+		req, _ := http.NewRequestWithContext(c.Req.Context(), "GET", inventoryURL, nil)
+		resp, err := client.Do(req)
+		...
+	})
+
+Logger 和 Recovery 的输出都带有 request ID, 可以把 panic 和访问日志对应起来.
+*/
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header the request ID is read from and sent in
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs accepted from the client
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDConfig configures the request ID middleware
+type RequestIDConfig struct {
+	// Header carries the ID, X-Request-ID by default
+	Header string
+	// Generator creates IDs for requests without a valid one, a random
+	// UUID by default
+	Generator func() string
+	// IgnoreIncoming always generates a new ID, for servers not behind a
+	// trusted proxy
+	IgnoreIncoming bool
+}
+
+// RequestID keeps the X-Request-ID of the request or generates a new one
+func RequestID() HandlerFunc {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig returns a request ID middleware for config. The ID
+// is available from Context.RequestID, from the request context through
+// RequestIDFromContext, and is echoed in the response header.
+func RequestIDWithConfig(config RequestIDConfig) HandlerFunc {
+	if config.Header == "" {
+		config.Header = RequestIDHeader
+	}
+	if config.Generator == nil {
+		config.Generator = newRequestID
+	}
+	return func(c *Context) {
+		id := ""
+		if !config.IgnoreIncoming {
+			id = c.Req.Header.Get(config.Header)
+		}
+		if !validRequestID(id) {
+			id = config.Generator()
+		}
+		c.requestID = id
+		c.Req = c.Req.WithContext(context.WithValue(c.Req.Context(), requestIDKey{}, id))
+		c.SetHeader(config.Header, id)
+		c.Next()
+	}
+}
+
+// RequestID returns the ID set by the RequestID middleware, or ""
+func (c *Context) RequestID() string {
+	return c.requestID
+}
+
+// RequestIDFromContext returns the request ID stored in ctx, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID only accepts short, printable IDs, so a client cannot
+// inject anything into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random version 4 UUID
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("gee: cannot read random bytes: " + err.Error())
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+// RequestIDTransport sets the X-Request-ID header of outgoing requests
+// whose context carries a request ID, see RequestIDFromContext
+type RequestIDTransport struct {
+	// Base sends the requests, http.DefaultTransport when nil
+	Base http.RoundTripper
+	// Header carries the ID, X-Request-ID by default
+	Header string
+}
+
+func (t *RequestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	header := t.Header
+	if header == "" {
+		header = RequestIDHeader
+	}
+	if id := RequestIDFromContext(req.Context()); id != "" && req.Header.Get(header) == "" {
+		// RoundTripper 不能修改传入的请求
+		req = req.Clone(req.Context())
+		req.Header.Set(header, id)
+	}
+	return base.RoundTrip(req)
+}
+
+// NewClient returns a copy of client (http.DefaultClient when nil) whose
+// requests forward the request ID of their context
+func NewClient(client *http.Client) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	cp := *client
+	cp.Transport = &RequestIDTransport{Base: client.Transport}
+	return &cp
+}
@@ -0,0 +1,68 @@
+package gee
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Header.Get("X-Request-ID"))
+	}))
+	defer upstream.Close()
+	client := NewClient(upstream.Client())
+
+	var out bytes.Buffer
+	r := New()
+	r.Use(RequestID(), LoggerWithConfig(LoggerConfig{Output: &out}))
+	r.GET("/proxy", func(c *Context) {
+		req, _ := http.NewRequestWithContext(c.Req.Context(), "GET", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		forwarded, _ := io.ReadAll(resp.Body)
+		if string(forwarded) != c.RequestID() {
+			t.Errorf("client forwarded %q, expected %q", forwarded, c.RequestID())
+		}
+		c.String(http.StatusOK, c.RequestID())
+	})
+
+	tests := []struct {
+		incoming string
+		kept     bool
+	}{
+		{"", false},
+		{"abc-123", true},
+		{"bad id\nforged=1", false},
+		{strings.Repeat("a", 200), false},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		req := httptest.NewRequest("GET", "/proxy", nil)
+		if tt.incoming != "" {
+			req.Header.Set("X-Request-ID", tt.incoming)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		id := w.Header().Get("X-Request-ID")
+		if id == "" || id != w.Body.String() {
+			t.Errorf("%q: response header %q does not match the context ID %q", tt.incoming, id, w.Body.String())
+		}
+		if kept := id == tt.incoming; kept != tt.kept {
+			t.Errorf("%q: expected kept %v, got ID %q", tt.incoming, tt.kept, id)
+		}
+		if !tt.kept && len(id) != 36 {
+			t.Errorf("%q: expected a generated UUID, got %q", tt.incoming, id)
+		}
+		if !strings.Contains(out.String(), "request_id="+id) {
+			t.Errorf("%q: access log lacks the request ID: %s", tt.incoming, out.String())
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gee
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/http"
+)
+
+/*
+ResponseWriter 记录实际发出的状态码和字节数.
+WriteHeader 只记录状态码, 第一次 Write (或 Flush, WriteHeaderNow) 时才真正发出响应头,
+因此在写 body 之前还可以修改状态码和响应头.
+*/
+
+// noWritten is the size before the headers are sent
+const noWritten = -1
+
+// ResponseWriter is the http.ResponseWriter of a Context. Middleware
+// replacing c.Writer should embed the current writer so the methods
+// keep reporting what was sent.
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	// Push returns http.ErrNotSupported unless the connection is HTTP/2
+	http.Pusher
+
+	// Status returns the status code of the response, 200 if none was set
+	Status() int
+	// Size returns the number of body bytes written, -1 before the
+	// headers are sent
+	Size() int
+	// Written reports whether the headers were sent
+	Written() bool
+	// WriteHeaderNow sends the headers with the current status code
+	WriteHeaderNow()
+	// Pusher returns the http.Pusher for HTTP/2 server push, or nil
+	Pusher() http.Pusher
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+	conns  *connRegistry // tracks hijacked connections when set
+}
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = noWritten
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if code > 0 && code < 200 {
+		// 1xx 之类的中间响应直接发送, 不影响最终状态码
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 && w.status != code {
+		if w.Written() {
+			if IsDebugging() {
+				log.Printf("[WARNING] headers were already written, status %d is ignored (sent %d)", code, w.status)
+			}
+			return
+		}
+		w.status = code
+	}
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseWriter) Write(data []byte) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = w.ResponseWriter.Write(data)
+	w.size += n
+	return
+}
+
+func (w *responseWriter) WriteString(s string) (n int, err error) {
+	w.WriteHeaderNow()
+	n, err = io.WriteString(w.ResponseWriter, s)
+	w.size += n
+	return
+}
+
+// ReadFrom keeps the sendfile path of http.FileServer
+func (w *responseWriter) ReadFrom(r io.Reader) (n int64, err error) {
+	w.WriteHeaderNow()
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(w.ResponseWriter, r)
+	}
+	w.size += int(n)
+	return
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.size != noWritten
+}
+
+func (w *responseWriter) Flush() {
+	w.WriteHeaderNow()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack takes over the connection, the response counts as written
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	if w.size < 0 {
+		w.size = 0
+	}
+	conn, brw, err := h.Hijack()
+	if err == nil && w.conns != nil {
+		conn = w.conns.track(conn)
+	}
+	return conn, brw, err
+}
+
+// Push starts an HTTP/2 server push through the underlying writer
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if p := w.Pusher(); p != nil {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+func (w *responseWriter) Pusher() http.Pusher {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p
+	}
+	return nil
+}
@@ -1,20 +1,33 @@
 package gee
 
 import (
-	//"log"
+	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
 type router struct {
-	roots    map[string]*node
-	handlers map[string]HandlerFunc
+	roots  map[string]*node
+	routes []*route // in registration order
+}
+
+// route is a registered endpoint together with its final handler chain
+type route struct {
+	method   string
+	pattern  string
+	handler  HandlerFunc
+	handlers []HandlerFunc // group middleware + handler, resolved on registration
+	name     string        // set by Route.Name
+	group    *RouteGroup   // the group the route was registered on
+	// bodyLimit is the maximum request body size, set by Route.BodyLimit
+	bodyLimit int64
 }
 
 func newRouter() *router {
 	return &router{
-		roots:    make(map[string]*node),
-		handlers: make(map[string]HandlerFunc),
+		roots: make(map[string]*node),
 	}
 }
 
@@ -34,58 +47,147 @@ func parsePattern(pattern string) []string {
 	return parts
 }
 
-func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
-	//log.Printf("Route %4s - %s", method, pattern)
-
+func (r *router) addRoute(method string, pattern string, handler HandlerFunc) *route {
 	parts := parsePattern(pattern)
-	key := method + "-" + pattern
 	_, ok := r.roots[method]
 	if !ok {
 		r.roots[method] = &node{}
 	}
-	r.roots[method].insert(pattern, parts, 0)
-	r.handlers[key] = handler
+	rt := &route{method: method, pattern: pattern, handler: handler, handlers: []HandlerFunc{handler}}
+	// 注册时发现冲突直接 panic, 让错误的路由表在启动时暴露
+	if err := r.roots[method].insert(pattern, parts, rt); err != nil {
+		panic(fmt.Sprintf("gee: route conflict: %s %s", method, err))
+	}
+	r.routes = append(r.routes, rt)
+	return rt
 }
 
-func (r *router) getRoute(method string, path string) (*node, map[string]string) {
-	searchPatrs := parsePattern(path)
-	params := make(map[string]string)
-	root, ok := r.roots[method]
+// buildURL fills the wildcards of pattern from params: a :param is escaped
+// as a single segment, a *catchall segment by segment
+func buildURL(pattern string, params map[string]string) (string, error) {
+	var b strings.Builder
+	used := make(map[string]bool)
+	for _, part := range parsePattern(pattern) {
+		b.WriteByte('/')
+		if part[0] != ':' && part[0] != '*' {
+			b.WriteString(part)
+			continue
+		}
+
+		key := part[1:]
+		value := params[key]
+		if key == "" || value == "" {
+			return "", fmt.Errorf("gee: missing value for '%s' in %s", part, pattern)
+		}
+		used[key] = true
+		if part[0] == ':' {
+			b.WriteString(url.PathEscape(value))
+			continue
+		}
+		segments := strings.FieldsFunc(value, func(r rune) bool { return r == '/' })
+		for i, segment := range segments {
+			segments[i] = url.PathEscape(segment)
+		}
+		b.WriteString(strings.Join(segments, "/"))
+	}
+	if b.Len() == 0 {
+		b.WriteByte('/')
+	}
+
+	query := url.Values{}
+	for key, value := range params {
+		if !used[key] {
+			query.Set(key, value)
+		}
+	}
+	if len(query) > 0 {
+		b.WriteString("?" + query.Encode())
+	}
+	return b.String(), nil
+}
+
+// cleanPath 把请求路径规范成与 parsePattern 一致的形式: 去掉空 segment 和结尾的 '/'.
+// 已经规范的路径原样返回, 不产生分配
+func cleanPath(p string) string {
+	if p != "" && p[0] == '/' && !strings.Contains(p, "//") && (len(p) == 1 || p[len(p)-1] != '/') {
+		return p
+	}
+
+	return "/" + strings.Join(strings.FieldsFunc(p, func(r rune) bool { return r == '/' }), "/")
+}
 
+// lookup finds the route for method and path, appending wildcards to ps
+func (r *router) lookup(method string, path string, ps *[]param) *node {
+	root, ok := r.roots[method]
 	if !ok {
-		return nil, nil
+		return nil
 	}
 
-	n := root.search(searchPatrs, 0)
+	return root.search(cleanPath(path), ps)
+}
 
-	if n != nil {
-		parts := parsePattern(n.pattern)
-		for index, part := range parts {
-			if part[0] == ':' {
-				params[part[1:]] = searchPatrs[index]
-			}
-			if part[0] == '*' && len(part) > 1 {
-				params[part[1:]] = strings.Join(searchPatrs[index:], "/")
-				break
-			}
-		}
+func (r *router) getRoute(method string, path string) (*node, map[string]string) {
+	var ps []param
+	n := r.lookup(method, path, &ps)
+	if n == nil {
+		return nil, nil
+	}
 
-		return n, params
+	params := make(map[string]string, len(ps))
+	for _, p := range ps {
+		params[p.key] = p.value
 	}
+	return n, params
+}
 
-	return nil, nil
+// allowed returns the methods that have a route matching path, sorted.
+// OPTIONS is always included because it is answered automatically.
+func (r *router) allowed(path string) []string {
+	methods := make([]string, 0, len(r.roots))
+	for method := range r.roots {
+		if method == http.MethodOptions {
+			continue
+		}
+		var ps []param
+		if r.lookup(method, path, &ps) != nil {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+	return methods
 }
 
 func (r *router) handle(c *Context) {
-	n, params := r.getRoute(c.Method, c.Path)
-	if n != nil {
-		c.Params = params
-		key := c.Method + "-" + n.pattern
-		r.handlers[key](c)
+	c.params = c.params[:0]
+	if n := r.lookup(c.Method, c.Path, &c.params); n != nil {
+		if c.Params == nil {
+			c.Params = make(map[string]string, len(c.params))
+		}
+		for _, p := range c.params {
+			c.Params[p.key] = p.value
+		}
+		c.handlers = n.route.handlers
+	} else if allow := r.allowed(c.Path); allow != nil {
+		c.handlers = append(c.engine.middlewaresFor(c.Path), func(c *Context) {
+			c.SetHeader("Allow", strings.Join(allow, ", "))
+			if c.Method == http.MethodOptions {
+				// 未注册 OPTIONS 路由时自动应答
+				c.Status(http.StatusNoContent)
+				return
+			}
+			c.String(http.StatusMethodNotAllowed, "serverdaz told you: 405 METHOD NOT ALLOWED: %s %s\n", c.Method, c.Path)
+		})
 	} else {
-		c.handlers = append(c.handlers, func(c *Context) {
+		c.handlers = append(c.engine.middlewaresFor(c.Path), func(c *Context) {
 			c.String(http.StatusNotFound, "serverdaz told you: 404 NOT FOUND: %s\n", c.Path)
 		})
 	}
 	c.Next()
+
+	// 状态码只是记录了下来 (例如 AbortWithStatus), 没有人写响应时在这里发出
+	c.Writer.WriteHeaderNow()
 }
@@ -2,6 +2,13 @@ package gee
 
 import (
 	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -34,3 +41,344 @@ func TestParsePattern(t *testing.T) {
 
 	fmt.Printf("match path: %s, params['name]: %s\n", n.pattern, ps["name"])
 }
+
+func TestMethodNotAllowed(t *testing.T) {
+	r := New()
+	r.GET("/user/:id", func(c *Context) { c.String(http.StatusOK, "get") })
+	r.DELETE("/user/:id", func(c *Context) { c.String(http.StatusOK, "delete") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/user/1", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "DELETE, GET, OPTIONS" {
+		t.Fatalf("unexpected Allow header %q", allow)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/user/1", nil))
+	if w.Code != http.StatusNoContent || w.Header().Get("Allow") == "" {
+		t.Fatalf("OPTIONS should be answered automatically, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/nothing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestRouteConflict(t *testing.T) {
+	conflicts := [][2]string{
+		{"/user/:id", "/user/:id"},
+		{"/user/:id", "/user/:name"},
+		{"/user/:id/posts", "/user/:name/likes"},
+		{"/assets/*filepath", "/assets/*file"},
+	}
+	for _, c := range conflicts {
+		func() {
+			defer func() {
+				err := recover()
+				if err == nil {
+					t.Fatalf("registering %s after %s should panic", c[1], c[0])
+				}
+				if msg := fmt.Sprint(err); !strings.Contains(msg, c[1]) {
+					t.Fatalf("panic message should name both routes: %s", msg)
+				}
+			}()
+			r := newRouter()
+			r.addRoute("GET", c[0], nil)
+			r.addRoute("GET", c[1], nil)
+		}()
+	}
+
+	// same pattern under another method is fine
+	r := newRouter()
+	r.addRoute("GET", "/user/:id", nil)
+	r.addRoute("POST", "/user/:id", nil)
+
+	// 静态, :param 和 *catchall 并列不再冲突: 按 静态 > :param > *catchall 的优先级匹配,
+	// 与注册顺序无关, 见 TestRoutePriority
+	siblings := []struct {
+		first, second, path, pattern string
+	}{
+		{"/assets/css", "/assets/*filepath", "/assets/css", "/assets/css"},
+		{"/assets/*filepath", "/assets/:name", "/assets/app.js", "/assets/:name"},
+	}
+	for _, s := range siblings {
+		r := newRouter()
+		r.addRoute("GET", s.first, nil)
+		r.addRoute("GET", s.second, nil)
+		if n, _ := r.getRoute("GET", s.path); n == nil || n.pattern != s.pattern {
+			t.Errorf("%s and %s: expected %s to match %s, got %v", s.first, s.second, s.path, s.pattern, n)
+		}
+	}
+}
+
+func TestRoutePriority(t *testing.T) {
+	routes := []string{
+		"/",
+		"/hello/:name",
+		"/hello/b/c",
+		"/hello/b/:id",
+		"/hello/:name/d",
+		"/hello/*rest",
+		"/hi/:name",
+		"/assets/*filepath",
+		"/assets/favicon.ico",
+		"/files/:dir/*file",
+		"/files/static/*file",
+	}
+	tests := []struct {
+		path    string
+		pattern string
+		params  map[string]string
+	}{
+		{"/", "/", map[string]string{}},
+		{"/hello/daz", "/hello/:name", map[string]string{"name": "daz"}},
+		{"/hello/b", "/hello/:name", map[string]string{"name": "b"}},
+		{"/hello/b/c", "/hello/b/c", map[string]string{}},
+		{"/hello/b/x", "/hello/b/:id", map[string]string{"id": "x"}},
+		// 静态分支 /hello/b 走不通时回溯到 :name
+		{"/hello/b/d", "/hello/b/:id", map[string]string{"id": "d"}},
+		{"/hello/x/d", "/hello/:name/d", map[string]string{"name": "x"}},
+		{"/hello/x/y", "/hello/*rest", map[string]string{"rest": "x/y"}},
+		{"/hello/b/c/d", "/hello/*rest", map[string]string{"rest": "b/c/d"}},
+		{"/hi/daz", "/hi/:name", map[string]string{"name": "daz"}},
+		{"/assets/favicon.ico", "/assets/favicon.ico", map[string]string{}},
+		{"/assets/css/daz.css", "/assets/*filepath", map[string]string{"filepath": "css/daz.css"}},
+		{"/files/static/a/b", "/files/static/*file", map[string]string{"file": "a/b"}},
+		{"/files/other/a/b", "/files/:dir/*file", map[string]string{"dir": "other", "file": "a/b"}},
+		{"/hi", "", nil},
+		{"/assets", "", nil},
+		{"/nothing/here", "", nil},
+	}
+
+	// 正序和逆序注册的结果必须一致
+	orders := [][]string{routes, make([]string, len(routes))}
+	for i, route := range routes {
+		orders[1][len(routes)-1-i] = route
+	}
+
+	for _, order := range orders {
+		r := newRouter()
+		for _, route := range order {
+			r.addRoute("GET", route, nil)
+		}
+		for _, tt := range tests {
+			n, ps := r.getRoute("GET", tt.path)
+			if tt.pattern == "" {
+				if n != nil {
+					t.Errorf("%s: expected no match, got %s", tt.path, n.pattern)
+				}
+				continue
+			}
+			if n == nil {
+				t.Errorf("%s: expected %s, got no match", tt.path, tt.pattern)
+				continue
+			}
+			if n.pattern != tt.pattern {
+				t.Errorf("%s: expected %s, got %s", tt.path, tt.pattern, n.pattern)
+			}
+			if !reflect.DeepEqual(ps, tt.params) {
+				t.Errorf("%s: expected params %v, got %v", tt.path, tt.params, ps)
+			}
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	r := newTestRouter()
+	tests := map[string]string{
+		"/hello/daz/":    "/hello/:name",
+		"//hello//daz":   "/hello/:name",
+		"hello/daz":      "/hello/:name",
+		"/assets//a//b/": "/assets/*filepath",
+		"":               "/",
+	}
+	for path, pattern := range tests {
+		n, _ := r.getRoute("GET", path)
+		if n == nil || n.pattern != pattern {
+			t.Errorf("%q should match %s", path, pattern)
+		}
+	}
+	if _, ps := r.getRoute("GET", "/assets//a//b/"); ps["filepath"] != "a/b" {
+		t.Errorf("filepath should be 'a/b', got %q", ps["filepath"])
+	}
+}
+
+// newBenchRouter registers a gateway sized route table
+func newBenchRouter() *router {
+	r := newTestRouter()
+	for i := 0; i < 1000; i++ {
+		r.addRoute("GET", fmt.Sprintf("/api/v1/service%d/users/:id", i), nil)
+		r.addRoute("GET", fmt.Sprintf("/api/v1/service%d/users/:id/posts/*rest", i), nil)
+		r.addRoute("POST", fmt.Sprintf("/api/v1/service%d/users", i), nil)
+	}
+	return r
+}
+
+func TestLookupZeroAlloc(t *testing.T) {
+	r := newBenchRouter()
+	ps := make([]param, 0, 8)
+	allocs := testing.AllocsPerRun(100, func() {
+		ps = ps[:0]
+		if r.lookup("GET", "/api/v1/service999/users/42/posts/2023/05", &ps) == nil {
+			t.Fatal("route should match")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("lookup should not allocate, got %v allocs", allocs)
+	}
+}
+
+func BenchmarkLookupStatic(b *testing.B) {
+	r := newBenchRouter()
+	ps := make([]param, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps = ps[:0]
+		r.lookup("GET", "/hello/b/c", &ps)
+	}
+}
+
+func BenchmarkLookupParam(b *testing.B) {
+	r := newBenchRouter()
+	ps := make([]param, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps = ps[:0]
+		r.lookup("GET", "/api/v1/service500/users/42", &ps)
+	}
+}
+
+func BenchmarkLookupCatchAll(b *testing.B) {
+	r := newBenchRouter()
+	ps := make([]param, 0, 8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps = ps[:0]
+		r.lookup("GET", "/api/v1/service999/users/42/posts/2023/05", &ps)
+	}
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var trace []string
+	mark := func(name string) HandlerFunc {
+		return func(c *Context) {
+			trace = append(trace, name)
+			c.Next()
+		}
+	}
+
+	r := New()
+	r.Use(mark("global"))
+	v1 := r.Group("/v1")
+	v1.GET("/users", func(c *Context) { c.String(http.StatusOK, "ok") })
+	// 注册路由之后再 Use 也要生效
+	v1.Use(mark("v1"))
+	r.GET("/v10/users", func(c *Context) { c.String(http.StatusOK, "ok") })
+
+	tests := []struct {
+		path  string
+		code  int
+		trace []string
+	}{
+		{"/v1/users", http.StatusOK, []string{"global", "v1"}},
+		{"/v10/users", http.StatusOK, []string{"global"}},
+		{"/v1/nothing", http.StatusNotFound, []string{"global", "v1"}},
+		{"/v10/nothing", http.StatusNotFound, []string{"global"}},
+	}
+	for _, tt := range tests {
+		trace = nil
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s: expected %d, got %d", tt.path, tt.code, w.Code)
+		}
+		if !reflect.DeepEqual(trace, tt.trace) {
+			t.Errorf("%s: expected middleware %v, got %v", tt.path, tt.trace, trace)
+		}
+	}
+}
+
+func TestURLFor(t *testing.T) {
+	r := New()
+	v1 := r.Group("/v1")
+	v1.GET("/user/:id", nil).Name("user.show")
+	v1.Any("/files/:dir/*filepath", nil).Name("files")
+	r.GET("/", nil).Name("index")
+
+	tests := []struct {
+		name   string
+		params map[string]string
+		url    string
+	}{
+		{"index", nil, "/"},
+		{"user.show", map[string]string{"id": "42"}, "/v1/user/42"},
+		{"user.show", map[string]string{"id": "a b/c"}, "/v1/user/a%20b%2Fc"},
+		{"user.show", map[string]string{"id": "42", "tab": "posts"}, "/v1/user/42?tab=posts"},
+		{"files", map[string]string{"dir": "docs", "filepath": "a b/c.txt"}, "/v1/files/docs/a%20b/c.txt"},
+	}
+	for _, tt := range tests {
+		url, err := r.URLFor(tt.name, tt.params)
+		if err != nil || url != tt.url {
+			t.Errorf("URLFor(%s, %v) = %q, %v; expected %q", tt.name, tt.params, url, err, tt.url)
+		}
+	}
+
+	if _, err := r.URLFor("user.show", nil); err == nil {
+		t.Error("missing params should fail")
+	}
+	if _, err := r.URLFor("nothing", nil); err == nil {
+		t.Error("unknown names should fail")
+	}
+
+	tmpl := template.Must(template.New("").Funcs(r.funcMap).Parse(`{{urlFor "user.show" "id" 7}}`))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, nil); err != nil || b.String() != "/v1/user/7" {
+		t.Errorf("urlFor template function rendered %q, %v", b.String(), err)
+	}
+}
+
+func testHandler(c *Context) {}
+
+func TestRoutes(t *testing.T) {
+	r := New()
+	r.Use(Logger())
+	v1 := r.Group("/v1")
+	v1.Use(Recovery())
+	v1.GET("/user/:id", testHandler).Name("user.show")
+	// BodyLimit 是路由自己的设置, 不算中间件
+	r.POST("/login", testHandler).BodyLimit(1 << 10)
+
+	expected := []RouteInfo{
+		{"GET", "/v1/user/:id", "gee.testHandler", 2, "/v1", "user.show"},
+		{"POST", "/login", "gee.testHandler", 1, "", ""},
+	}
+	if routes := r.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Fatalf("expected routes %+v, got %+v", expected, routes)
+	}
+}
+
+func TestStatic(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "css"), 0o755)
+	os.WriteFile(filepath.Join(dir, "css", "app.css"), []byte("body{}"), 0o644)
+	r := New()
+	r.Group("/v1").Static("/assets", dir)
+
+	// 注册的是 catch-all "/v1/assets/*filepath", 而不是 "/v1/assets/*/filepath"
+	if routes := r.Routes(); len(routes) != 1 || routes[0].Pattern != "/v1/assets/*filepath" {
+		t.Fatalf("unexpected static routes %+v", routes)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/assets/css/app.css", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "body{}" {
+		t.Errorf("expected the file, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,277 @@
+package gee
+
+/*
+server lifecycle
+
+	r.HandleSignals = true // SIGINT/SIGTERM 时优雅退出
+	r.OnShutdown(func(ctx context.Context) error { return db.Close() })
+	if err := r.Run(":9999"); err != nil {
+		log.Fatal(err)
+	}
+
+Shutdown 先停止接受新连接, 等进行中的请求处理完, 关闭被接管的连接 (例如 WebSocket),
+再按注册的逆序执行 OnShutdown 钩子;
+Run 在这之后才返回, 所以 main 返回时资源已经释放.
+*/
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultShutdownTimeout bounds the shutdown triggered by a signal
+	defaultShutdownTimeout = 30 * time.Second
+	// defaultShutdownHookTimeout is Engine.ShutdownHookTimeout unless set
+	defaultShutdownHookTimeout = 5 * time.Second
+)
+
+// runningServer is the server of one Run call
+type runningServer struct {
+	srv  *http.Server  // nil once shutdown has started
+	done chan struct{} // closed once shutdown has finished
+	err  error
+}
+
+// OnStart registers fn to run once the listener is ready, before requests
+// are served. An error stops Run and is returned by it.
+func (engine *Engine) OnStart(fn func() error) {
+	engine.startHooks = append(engine.startHooks, fn)
+}
+
+// OnShutdown registers fn to run after the server has drained, in reverse
+// registration order, e.g. to close database connections
+func (engine *Engine) OnShutdown(fn func(ctx context.Context) error) {
+	engine.shutdownHooks = append(engine.shutdownHooks, fn)
+}
+
+// Run serves HTTP on addr, ":http" when empty, until Shutdown is called.
+// It returns nil after a graceful shutdown.
+func (engine *Engine) Run(addr string) error {
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return engine.serve(ln, "", "")
+}
+
+// RUN is the original name of Run.
+//
+// Deprecated: use Run.
+func (engine *Engine) RUN(addr string) error {
+	return engine.Run(addr)
+}
+
+// RunTLS serves HTTPS on addr, ":https" when empty, see Run
+func (engine *Engine) RunTLS(addr string, certFile string, keyFile string) error {
+	if addr == "" {
+		addr = ":https"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return engine.serve(ln, certFile, keyFile)
+}
+
+// RunListener serves HTTP on ln, see Run. ln is closed when Run returns.
+func (engine *Engine) RunListener(ln net.Listener) error {
+	return engine.serve(ln, "", "")
+}
+
+// RunUnix serves HTTP on the unix socket file, see Run. A socket left
+// behind by a previous process is replaced.
+func (engine *Engine) RunUnix(file string) error {
+	if info, err := os.Stat(file); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(file)
+	}
+	ln, err := net.Listen("unix", file)
+	if err != nil {
+		return err
+	}
+	return engine.serve(ln, "", "")
+}
+
+func (engine *Engine) serve(ln net.Listener, certFile string, keyFile string) error {
+	srv := &http.Server{
+		Handler:           engine,
+		ReadTimeout:       engine.ReadTimeout,
+		ReadHeaderTimeout: engine.ReadHeaderTimeout,
+		WriteTimeout:      engine.WriteTimeout,
+		IdleTimeout:       engine.IdleTimeout,
+	}
+	s := &runningServer{srv: srv, done: make(chan struct{})}
+	engine.serverMu.Lock()
+	if engine.running != nil {
+		engine.serverMu.Unlock()
+		ln.Close()
+		return errors.New("gee: server is already running")
+	}
+	engine.running = s
+	engine.serverMu.Unlock()
+	defer func() {
+		engine.serverMu.Lock()
+		engine.running = nil
+		engine.serverMu.Unlock()
+	}()
+
+	if IsDebugging() {
+		engine.printRoutes()
+		log.Printf("Listening on %s", ln.Addr())
+	}
+	for _, fn := range engine.startHooks {
+		if err := fn(); err != nil {
+			ln.Close()
+			return errors.Join(err, engine.shutdown(context.Background(), s))
+		}
+	}
+
+	if engine.HandleSignals {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go func() {
+			select {
+			case sig := <-signals:
+				log.Printf("%v received, shutting down", sig)
+				timeout := engine.ShutdownTimeout
+				if timeout <= 0 {
+					timeout = defaultShutdownTimeout
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), timeout)
+				defer cancel()
+				if err := engine.shutdown(ctx, s); err != nil {
+					log.Printf("shutdown: %v", err)
+				}
+			case <-s.done:
+			}
+		}()
+	}
+
+	var err error
+	if certFile != "" || keyFile != "" {
+		err = srv.ServeTLS(ln, certFile, keyFile)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		// Serve 在 Shutdown 开始时就返回了, 等它完成
+		<-s.done
+		return s.err
+	}
+	// 监听出错也要执行 OnShutdown, 启动时打开的资源需要释放
+	return errors.Join(err, engine.shutdown(context.Background(), s))
+}
+
+// Shutdown stops the running server gracefully: it stops accepting
+// connections, waits for active requests until ctx is done, closes the
+// rest and the hijacked connections (e.g. WebSockets) and then runs the OnShutdown hooks, which get ShutdownHookTimeout
+// of their own when ctx is already done. It does nothing when no server
+// is running.
+func (engine *Engine) Shutdown(ctx context.Context) error {
+	engine.serverMu.Lock()
+	s := engine.running
+	engine.serverMu.Unlock()
+	if s == nil {
+		return nil
+	}
+	return engine.shutdown(ctx, s)
+}
+
+// shutdown runs once per server, later calls wait for the first one
+func (engine *Engine) shutdown(ctx context.Context, s *runningServer) error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+	}
+
+	engine.serverMu.Lock()
+	if s.srv == nil {
+		// 另一个调用正在关闭
+		engine.serverMu.Unlock()
+		<-s.done
+		return s.err
+	}
+	srv := s.srv
+	s.srv = nil
+	engine.serverMu.Unlock()
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		// 超时之后强制关闭剩下的连接
+		srv.Close()
+	}
+	// http.Server 不再管理被接管的连接, 需要自己关闭
+	engine.hijacked.closeAll()
+	hookCtx := ctx
+	if ctx.Err() != nil {
+		// 等待请求已经用完了 ctx, 钩子另外给一段时间, 否则拿到的是已经过期的 ctx
+		timeout := engine.ShutdownHookTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownHookTimeout
+		}
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+	}
+	for i := len(engine.shutdownHooks) - 1; i >= 0; i-- {
+		err = errors.Join(err, engine.shutdownHooks[i](hookCtx))
+	}
+	s.err = err
+	close(s.done)
+	return err
+}
+
+// connRegistry holds the connections taken over through Hijack, which
+// http.Server stops tracking, so Shutdown can close them
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+// track registers conn until it is closed
+func (r *connRegistry) track(conn net.Conn) net.Conn {
+	tc := &trackedConn{Conn: conn, registry: r}
+	r.mu.Lock()
+	if r.conns == nil {
+		r.conns = make(map[*trackedConn]struct{})
+	}
+	r.conns[tc] = struct{}{}
+	r.mu.Unlock()
+	return tc
+}
+
+func (r *connRegistry) closeAll() {
+	r.mu.Lock()
+	conns := r.conns
+	r.conns = nil
+	r.mu.Unlock()
+	for tc := range conns {
+		tc.Conn.Close()
+	}
+}
+
+// trackedConn leaves its registry when closed
+type trackedConn struct {
+	net.Conn
+	registry *connRegistry
+}
+
+func (c *trackedConn) Close() error {
+	c.registry.mu.Lock()
+	delete(c.registry.conns, c)
+	c.registry.mu.Unlock()
+	return c.Conn.Close()
+}
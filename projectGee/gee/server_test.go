@@ -0,0 +1,185 @@
+package gee
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	var events []string
+
+	r := New()
+	r.GET("/slow", func(c *Context) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	r.OnStart(func() error {
+		events = append(events, "start")
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "db closed")
+		return nil
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		events = append(events, "cache closed")
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() { result <- r.RunListener(ln) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 进行中的请求在 Shutdown 返回之前完成
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request was cut off: %q", got)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("Run should return nil after a graceful shutdown, got %v", err)
+	}
+	expected := []string{"start", "cache closed", "db closed"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected hooks %v, got %v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Fatalf("expected hooks %v, got %v", expected, events)
+		}
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown without a running server should do nothing, got %v", err)
+	}
+}
+
+func TestRunUnixStartHookError(t *testing.T) {
+	failed := errors.New("migrations failed")
+	closed := false
+
+	r := New()
+	r.OnStart(func() error { return failed })
+	r.OnShutdown(func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	err := r.RunUnix(filepath.Join(t.TempDir(), "gee.sock"))
+	if !errors.Is(err, failed) {
+		t.Errorf("expected the start hook error, got %v", err)
+	}
+	if !closed {
+		t.Error("shutdown hooks should run when a start hook fails")
+	}
+}
+
+func TestShutdownHookTimeout(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	hookErr := make(chan error, 1)
+
+	r := New()
+	r.ShutdownHookTimeout = time.Second
+	r.GET("/stuck", func(c *Context) {
+		close(started)
+		<-release
+	})
+	r.OnShutdown(func(ctx context.Context) error {
+		hookErr <- ctx.Err()
+		return nil
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.RunListener(ln)
+	go http.Get("http://" + ln.Addr().String() + "/stuck")
+	<-started
+
+	// 请求没有在 ctx 结束前完成, 钩子仍然拿到一个还没过期的 ctx
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the drain to time out, got %v", err)
+	}
+	if err := <-hookErr; err != nil {
+		t.Errorf("hooks should get a fresh context, got one that is %v", err)
+	}
+}
+
+func TestShutdownClosesHijacked(t *testing.T) {
+	hijacked := make(chan struct{})
+	readErr := make(chan error, 1)
+
+	r := New()
+	r.GET("/raw", func(c *Context) {
+		conn, _, err := c.Writer.Hijack()
+		if err != nil {
+			readErr <- err
+			return
+		}
+		defer conn.Close()
+		close(hijacked)
+		_, err = conn.Read(make([]byte, 1))
+		readErr <- err
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go r.RunListener(ln)
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	io.WriteString(client, "GET /raw HTTP/1.1\r\nHost: gee\r\n\r\n")
+	<-hijacked
+
+	// 被接管的连接不归 http.Server 管, Shutdown 需要自己关闭它
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-readErr:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("expected the hijacked connection to be closed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the hijacked connection was left open")
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("the client should see the connection closed, got %v", err)
+	}
+}
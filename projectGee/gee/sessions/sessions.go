@@ -0,0 +1,272 @@
+/*
+Package sessions 为 gee 提供 session 支持
+
+	r.CookieSigningKeys = [][]byte{key}
+	r.Use(sessions.Sessions("gee_session", sessions.NewCookieStore(), sessions.Options{
+		IdleTimeout:     30 * time.Minute,
+		AbsoluteTimeout: 24 * time.Hour,
+	}))
+
+	r.POST("/login", func(c *gee.Context) {
+		s := sessions.Default(c)
+		s.Regenerate() // 登录后更换 session ID, 防止 session fixation
+		s.Set("user", name)
+		s.AddFlash("welcome back")
+		c.String(http.StatusOK, "ok")
+	})
+
+修改过的 session 在响应写出之前自动保存, 也可以显式调用 Save 处理错误.
+*/
+package sessions
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"time"
+
+	"gee"
+)
+
+// DefaultKey is the Context key the session is stored under
+const DefaultKey = "gee/sessions"
+
+// now is replaced in tests
+var now = time.Now
+
+// Options configure the Sessions middleware
+type Options struct {
+	// Cookie are the attributes of the session cookie, nil uses
+	// Engine.CookieOptions
+	Cookie *gee.CookieOptions
+	// IdleTimeout expires a session not used for this long, 0 disables it
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires a session this long after it was created,
+	// regardless of activity. 0 disables it
+	AbsoluteTimeout time.Duration
+}
+
+// Session is the session of the current request, see Default
+type Session struct {
+	name      string
+	store     Store
+	opts      Options
+	c         *gee.Context
+	data      *Data
+	isNew     bool
+	modified  bool
+	destroyed bool
+	oldIDs    []string // replaced by Regenerate, deleted from the store on save
+}
+
+// Sessions loads the session named name from store for every request.
+// Expired sessions are deleted and replaced by a new, empty one.
+func Sessions(name string, store Store, opts Options) gee.HandlerFunc {
+	return func(c *gee.Context) {
+		s := &Session{name: name, store: store, opts: opts, c: c}
+		t := now()
+
+		data, err := store.Load(c, name)
+		if err != nil {
+			c.Error(err)
+		}
+		if data != nil && s.expired(data, t) {
+			if err := store.Delete(c, data.ID); err != nil {
+				c.Error(err)
+			}
+			data = nil
+		}
+		if data == nil {
+			data = &Data{ID: newID(), CreatedAt: t}
+			s.isNew = true
+		}
+		if data.Values == nil {
+			data.Values = make(map[string]interface{})
+		}
+		s.data = data
+		s.data.AccessedAt = t
+		// 空闲超时需要在每次请求后刷新访问时间
+		if opts.IdleTimeout > 0 && !s.isNew {
+			s.modified = true
+		}
+
+		c.Set(DefaultKey, s)
+		c.Writer = &sessionWriter{ResponseWriter: c.Writer, session: s}
+		c.Next()
+		s.saveOnWrite()
+	}
+}
+
+// Default returns the session loaded by the Sessions middleware
+func Default(c *gee.Context) *Session {
+	s, _ := gee.Value[*Session](c, DefaultKey)
+	return s
+}
+
+func (s *Session) expired(data *Data, now time.Time) bool {
+	if data.expired(now) {
+		return true
+	}
+	if s.opts.IdleTimeout > 0 && now.Sub(data.AccessedAt) >= s.opts.IdleTimeout {
+		return true
+	}
+	return s.opts.AbsoluteTimeout > 0 && now.Sub(data.CreatedAt) >= s.opts.AbsoluteTimeout
+}
+
+// newID returns a random, URL safe session ID
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("sessions: cannot read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// validID rejects cookie values that cannot be IDs made by newID, which
+// keeps them safe to use as file names
+func validID(id string) bool {
+	if len(id) != base64.RawURLEncoding.EncodedLen(32) {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ID returns the session ID
+func (s *Session) ID() string {
+	return s.data.ID
+}
+
+// IsNew reports whether the session was created by this request
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) Get(key string) interface{} {
+	return s.data.Values[key]
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.data.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	delete(s.data.Values, key)
+	s.modified = true
+}
+
+// Clear removes all values, the session itself stays
+func (s *Session) Clear() {
+	s.data.Values = make(map[string]interface{})
+	s.modified = true
+}
+
+// AddFlash adds a message that is kept until it is read with Flashes
+func (s *Session) AddFlash(value interface{}) {
+	s.data.Flashes = append(s.data.Flashes, value)
+	s.modified = true
+}
+
+// Flashes returns and removes the flash messages
+func (s *Session) Flashes() []interface{} {
+	flashes := s.data.Flashes
+	if len(flashes) > 0 {
+		s.data.Flashes = nil
+		s.modified = true
+	}
+	return flashes
+}
+
+// Regenerate moves the session to a new ID and drops the old one, call it
+// when the privilege level changes, e.g. on login
+func (s *Session) Regenerate() {
+	if !s.isNew {
+		s.oldIDs = append(s.oldIDs, s.data.ID)
+	}
+	s.data.ID = newID()
+	s.isNew = true
+	s.modified = true
+}
+
+// Destroy deletes the session from the store and the client, e.g. on logout
+func (s *Session) Destroy() {
+	s.destroyed = true
+	s.modified = true
+}
+
+// Save persists the session and sets its cookie. It must run before the
+// response is written, which the middleware takes care of for modified
+// sessions.
+func (s *Session) Save() error {
+	s.modified = false
+	for _, id := range s.oldIDs {
+		if err := s.store.Delete(s.c, id); err != nil {
+			return err
+		}
+	}
+	s.oldIDs = nil
+
+	if s.destroyed {
+		s.c.DeleteCookie(s.name, s.opts.Cookie)
+		if s.isNew {
+			return nil
+		}
+		return s.store.Delete(s.c, s.data.ID)
+	}
+
+	s.data.ExpiresAt = time.Time{}
+	if s.opts.IdleTimeout > 0 {
+		s.data.ExpiresAt = s.data.AccessedAt.Add(s.opts.IdleTimeout)
+	}
+	if s.opts.AbsoluteTimeout > 0 {
+		if absolute := s.data.CreatedAt.Add(s.opts.AbsoluteTimeout); s.data.ExpiresAt.IsZero() || absolute.Before(s.data.ExpiresAt) {
+			s.data.ExpiresAt = absolute
+		}
+	}
+	return s.store.Save(s.c, s.name, s.data, s.opts.Cookie)
+}
+
+// saveOnWrite saves a modified session, collecting the error on the Context
+func (s *Session) saveOnWrite() {
+	if !s.modified {
+		return
+	}
+	if err := s.Save(); err != nil {
+		s.c.Error(err)
+	}
+}
+
+// sessionWriter saves the session right before the response headers are
+// sent, the last moment the session cookie can still be set
+type sessionWriter struct {
+	gee.ResponseWriter
+	session *Session
+}
+
+func (w *sessionWriter) WriteHeaderNow() {
+	w.session.saveOnWrite()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.session.saveOnWrite()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) Flush() {
+	w.session.saveOnWrite()
+	w.ResponseWriter.Flush()
+}
+
+// Hijack saves first, a handler taking over the connection (e.g. a
+// WebSocket handshake) writes the response headers itself
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.session.saveOnWrite()
+	return w.ResponseWriter.Hijack()
+}
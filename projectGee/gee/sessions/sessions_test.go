@@ -0,0 +1,200 @@
+package sessions
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gee"
+)
+
+// client replays the cookies it receives, like a browser
+type client struct {
+	t       *testing.T
+	engine  *gee.Engine
+	cookies map[string]*http.Cookie
+}
+
+func (cl *client) get(path string) string {
+	req := httptest.NewRequest("GET", path, nil)
+	for _, cookie := range cl.cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	cl.engine.ServeHTTP(w, req)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.MaxAge < 0 {
+			delete(cl.cookies, cookie.Name)
+		} else {
+			cl.cookies[cookie.Name] = cookie
+		}
+	}
+	return w.Body.String()
+}
+
+func newTestEngine(t *testing.T, store Store, opts Options) *client {
+	r := gee.New()
+	r.CookieSigningKeys = [][]byte{[]byte("secret")}
+	r.Use(Sessions("session", store, opts))
+	r.GET("/login", func(c *gee.Context) {
+		s := Default(c)
+		s.Regenerate()
+		s.Set("user", "daz")
+		s.AddFlash("welcome")
+		c.String(http.StatusOK, s.ID())
+	})
+	r.GET("/me", func(c *gee.Context) {
+		s := Default(c)
+		user, _ := s.Get("user").(string)
+		flashes := s.Flashes()
+		c.String(http.StatusOK, "%s %v", user, flashes)
+	})
+	r.GET("/logout", func(c *gee.Context) {
+		Default(c).Destroy()
+		c.String(http.StatusOK, "bye")
+	})
+	return &client{t: t, engine: r, cookies: make(map[string]*http.Cookie)}
+}
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"cookie": NewCookieStore(),
+		"file":   fileStore,
+	}
+
+	for name, store := range stores {
+		cl := newTestEngine(t, store, Options{})
+		if got := cl.get("/me"); got != " []" {
+			t.Errorf("%s: anonymous request got %q", name, got)
+		}
+		cl.get("/login")
+		if got := cl.get("/me"); got != "daz [welcome]" {
+			t.Errorf("%s: expected user and flash, got %q", name, got)
+		}
+		// flash 只能读一次
+		if got := cl.get("/me"); got != "daz []" {
+			t.Errorf("%s: flash should be gone, got %q", name, got)
+		}
+		cl.get("/logout")
+		if got := cl.get("/me"); got != " []" {
+			t.Errorf("%s: session should be destroyed, got %q", name, got)
+		}
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	store := NewMemoryStore()
+	cl := newTestEngine(t, store, Options{})
+	first := cl.get("/login")
+	stolen := cl.cookies["session"]
+	second := cl.get("/login")
+	if first == second {
+		t.Fatal("login should issue a new session ID")
+	}
+
+	// 旧的 session ID 已经失效
+	attacker := &client{t: t, engine: cl.engine, cookies: map[string]*http.Cookie{"session": stolen}}
+	if got := attacker.get("/me"); got != " []" {
+		t.Errorf("old session ID should be dropped, got %q", got)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	defer func() { now = time.Now }()
+	start := time.Now()
+	clock := start
+	now = func() time.Time { return clock }
+
+	cl := newTestEngine(t, NewMemoryStore(), Options{IdleTimeout: 10 * time.Minute, AbsoluteTimeout: time.Hour})
+	cl.get("/login")
+	cl.get("/me")
+
+	// 活跃的 session 不会空闲过期, 但到了绝对过期时间一定失效
+	for clock = start.Add(5 * time.Minute); clock.Before(start.Add(time.Hour)); clock = clock.Add(5 * time.Minute) {
+		if got := cl.get("/me"); !strings.HasPrefix(got, "daz") {
+			t.Fatalf("session expired too early at %v: %q", clock.Sub(start), got)
+		}
+	}
+	if got := cl.get("/me"); got != " []" {
+		t.Errorf("session should expire after the absolute timeout, got %q", got)
+	}
+
+	cl.get("/login")
+	clock = clock.Add(11 * time.Minute)
+	if got := cl.get("/me"); got != " []" {
+		t.Errorf("session should expire after the idle timeout, got %q", got)
+	}
+}
+
+func TestSessionWriter(t *testing.T) {
+	r := gee.New()
+	r.CookieSigningKeys = [][]byte{[]byte("secret")}
+	r.Use(Sessions("session", NewMemoryStore(), Options{}))
+	r.GET("/stream", func(c *gee.Context) {
+		Default(c).Set("user", "daz")
+		c.Writer.Write([]byte("first "))
+		c.Writer.(http.Flusher).Flush()
+		c.Writer.Write([]byte("second"))
+	})
+	r.GET("/now", func(c *gee.Context) {
+		Default(c).Set("user", "early")
+		c.Writer.WriteHeaderNow()
+		c.Writer.Write([]byte("ok"))
+	})
+	r.GET("/hijack", func(c *gee.Context) {
+		Default(c).Set("user", "hijacked")
+		conn, brw, err := c.Writer.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		// 接管连接的 handler 自己写响应, session cookie 在 hijack 之前已经设置好
+		fmt.Fprintf(brw, "HTTP/1.1 200 OK\r\nSet-Cookie: %s\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok",
+			c.Writer.Header().Get("Set-Cookie"))
+		brw.Flush()
+	})
+	r.GET("/me", func(c *gee.Context) {
+		user, _ := Default(c).Get("user").(string)
+		c.String(http.StatusOK, user)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	get := func(path string, cookies []*http.Cookie) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	body := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	for path, user := range map[string]string{"/stream": "daz", "/now": "early", "/hijack": "hijacked"} {
+		resp := get(path, nil)
+		body(resp)
+		if len(resp.Cookies()) != 1 {
+			t.Fatalf("%s: expected the session cookie, got %v", path, resp.Header["Set-Cookie"])
+		}
+		if got := body(get("/me", resp.Cookies())); got != user {
+			t.Errorf("%s: expected the saved session of %s, got %q", path, user, got)
+		}
+	}
+}
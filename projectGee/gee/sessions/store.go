@@ -0,0 +1,245 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gee"
+)
+
+// Data is what a Store persists for one session. Values and flashes go
+// through encoding/json in the cookie and file stores, so numbers come
+// back as float64 there.
+type Data struct {
+	ID         string                 `json:"id"`
+	Values     map[string]interface{} `json:"values,omitempty"`
+	Flashes    []interface{}          `json:"flashes,omitempty"`
+	CreatedAt  time.Time              `json:"created_at"`
+	AccessedAt time.Time              `json:"accessed_at"`
+	ExpiresAt  time.Time              `json:"expires_at"` // zero if the session never expires
+}
+
+// expired reports whether the session is past ExpiresAt
+func (d *Data) expired(now time.Time) bool {
+	return !d.ExpiresAt.IsZero() && !now.Before(d.ExpiresAt)
+}
+
+// clone copies d so that a stored session is not shared between requests
+func (d *Data) clone() *Data {
+	cp := *d
+	cp.Values = make(map[string]interface{}, len(d.Values))
+	for key, value := range d.Values {
+		cp.Values[key] = value
+	}
+	cp.Flashes = append([]interface{}(nil), d.Flashes...)
+	return &cp
+}
+
+// Store loads and persists sessions
+type Store interface {
+	// Load returns the session data of the request, nil when it has none
+	Load(c *gee.Context, name string) (*Data, error)
+	// Save persists data and sets the session cookie
+	Save(c *gee.Context, name string, data *Data, cookie *gee.CookieOptions) error
+	// Delete removes the data of the session with id, the session cookie
+	// is removed by the caller
+	Delete(c *gee.Context, id string) error
+}
+
+// Backend keeps session data on the server, see NewServerStore
+type Backend interface {
+	// Get returns the data stored under id, nil when there is none
+	Get(id string) (*Data, error)
+	Put(data *Data) error
+	Remove(id string) error
+}
+
+// serverStore only keeps the session ID in the cookie
+type serverStore struct {
+	backend Backend
+}
+
+// NewServerStore returns a Store that keeps the data in backend and only
+// the random session ID in the cookie
+func NewServerStore(backend Backend) Store {
+	return &serverStore{backend: backend}
+}
+
+func (s *serverStore) Load(c *gee.Context, name string) (*Data, error) {
+	id, err := c.Cookie(name)
+	if err != nil || !validID(id) {
+		return nil, nil
+	}
+	return s.backend.Get(id)
+}
+
+func (s *serverStore) Save(c *gee.Context, name string, data *Data, cookie *gee.CookieOptions) error {
+	if err := s.backend.Put(data); err != nil {
+		return err
+	}
+	c.SetCookie(name, data.ID, cookie)
+	return nil
+}
+
+func (s *serverStore) Delete(c *gee.Context, id string) error {
+	return s.backend.Remove(id)
+}
+
+// memoryBackend keeps sessions in a map, expired entries are purged on Put
+type memoryBackend struct {
+	mu       sync.Mutex
+	sessions map[string]*Data
+	puts     int
+}
+
+// NewMemoryStore returns a Store keeping sessions in process memory.
+// Sessions are lost on restart and not shared between processes.
+func NewMemoryStore() Store {
+	return NewServerStore(&memoryBackend{sessions: make(map[string]*Data)})
+}
+
+func (m *memoryBackend) Get(id string) (*Data, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	return data.clone(), nil
+}
+
+func (m *memoryBackend) Put(data *Data) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[data.ID] = data.clone()
+
+	// 每写入 1024 次清理一次过期的 session
+	if m.puts++; m.puts%1024 == 0 {
+		t := now()
+		for id, d := range m.sessions {
+			if d.expired(t) {
+				delete(m.sessions, id)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *memoryBackend) Remove(id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+	return nil
+}
+
+// fileBackend stores one JSON file per session in dir
+type fileBackend struct {
+	dir string
+}
+
+// NewFileStore returns a Store keeping one JSON file per session in dir
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return NewServerStore(&fileBackend{dir: dir}), nil
+}
+
+func (f *fileBackend) path(id string) string {
+	return filepath.Join(f.dir, id+".json")
+}
+
+func (f *fileBackend) Get(id string) (*Data, error) {
+	raw, err := os.ReadFile(f.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data Data
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+func (f *fileBackend) Put(data *Data) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名, 并发读取不会看到写了一半的文件
+	tmp, err := os.CreateTemp(f.dir, data.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(data.ID))
+}
+
+func (f *fileBackend) Remove(id string) error {
+	if err := os.Remove(f.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// maxCookieSize is the size browsers are guaranteed to keep for a cookie
+const maxCookieSize = 4096
+
+// cookieStore keeps the whole session in a signed cookie
+type cookieStore struct{}
+
+// NewCookieStore returns a Store keeping the whole session in a cookie
+// signed with Engine.CookieSigningKeys. The data is readable by the
+// client and limited to about 4 KB.
+func NewCookieStore() Store {
+	return cookieStore{}
+}
+
+func (cookieStore) Load(c *gee.Context, name string) (*Data, error) {
+	raw, err := c.SignedCookie(name)
+	if errors.Is(err, gee.ErrNoCookieKeys) {
+		return nil, err
+	}
+	if err != nil {
+		// 没有 cookie 或者签名不对都当作新 session
+		return nil, nil
+	}
+	var data Data
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, nil
+	}
+	return &data, nil
+}
+
+func (cookieStore) Save(c *gee.Context, name string, data *Data, cookie *gee.CookieOptions) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// base64 编码之后再加上 '.' 和 43 字节的签名
+	if size := base64.RawURLEncoding.EncodedLen(len(raw)) + 44; size > maxCookieSize {
+		return fmt.Errorf("sessions: session %s needs a %d byte cookie, more than %d", name, size, maxCookieSize)
+	}
+	return c.SetSignedCookie(name, string(raw), cookie)
+}
+
+func (cookieStore) Delete(c *gee.Context, id string) error {
+	return nil
+}
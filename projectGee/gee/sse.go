@@ -0,0 +1,284 @@
+package gee
+
+/*
+流式响应与 Server-Sent Events
+
+	r.GET("/metrics/live", func(c *gee.Context) {
+		c.SSEStream(updates, 15*time.Second) // 每 15 秒发一行注释保持连接
+	})
+
+	r.GET("/ticks", func(c *gee.Context) {
+		c.Stream(func(w io.Writer) bool {
+			c.SSEvent("tick", time.Now())
+			time.Sleep(time.Second)
+			return true
+		})
+	})
+
+Stream 写出的 event stream 空闲 Engine.StreamHeartbeat (默认 15 秒) 时同样会发注释.
+客户端断开时 c.Req.Context() 会被取消, Stream 和 SSEStream 随之返回.
+Engine.WriteTimeout 对流式响应同样生效, 长连接需要把它设为 0.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultStreamHeartbeat is Engine.StreamHeartbeat unless set
+const defaultStreamHeartbeat = 15 * time.Second
+
+// ServerEvent is one Server-Sent Event
+type ServerEvent struct {
+	// Event is the event type, "message" on the client when empty
+	Event string
+	// ID sets the last event ID the client reconnects with
+	ID string
+	// Retry tells the client how long to wait before reconnecting
+	Retry time.Duration
+	// Data is sent as is for strings and []byte, as JSON otherwise
+	Data interface{}
+}
+
+// Stream calls step and flushes what it wrote until step returns false or
+// the client disconnects. It reports whether the client disconnected.
+//
+// step runs on its own goroutine, so an event stream idle for
+// Engine.StreamHeartbeat gets a comment even while step waits for data.
+// A step that blocks should also return once c.Req.Context() is done,
+// Stream waits for it before returning.
+func (c *Context) Stream(step func(w io.Writer) bool) bool {
+	done := c.Req.Context().Done()
+	w := &streamWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	defer func() { c.Writer = w.ResponseWriter }()
+
+	finished := make(chan struct{})
+	var panicked interface{}
+	go func() {
+		defer close(finished)
+		defer func() { panicked = recover() }()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			keepOpen := step(w)
+			w.Flush()
+			if !keepOpen {
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if c.engine != nil && c.engine.StreamHeartbeat > 0 {
+		ticker := time.NewTicker(c.engine.StreamHeartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-finished:
+			if panicked != nil {
+				// 交给 Recovery 处理, 和 handler 自己 panic 一样
+				panic(panicked)
+			}
+			select {
+			case <-done:
+				return true
+			default:
+				return false
+			}
+		case <-tick:
+			w.heartbeat()
+		}
+	}
+}
+
+// SSEvent sends an event named name and flushes it, see SendEvent
+func (c *Context) SSEvent(name string, data interface{}) error {
+	return c.SendEvent(ServerEvent{Event: name, Data: data})
+}
+
+// SendEvent writes ev in the text/event-stream format and flushes it.
+// The first event sets the headers of the stream.
+func (c *Context) SendEvent(ev ServerEvent) error {
+	var buf bytes.Buffer
+	if ev.Event != "" {
+		buf.WriteString("event: " + sseField(ev.Event) + "\n")
+	}
+	if ev.ID != "" {
+		buf.WriteString("id: " + sseField(ev.ID) + "\n")
+	}
+	if ev.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var data string
+	switch d := ev.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(b)
+	}
+	// 多行数据每行一个 data 字段, 客户端会用换行拼回去.
+	// 单独的 \r 对客户端也是换行, 必须一样拆开, 否则可以伪造出别的字段
+	for _, line := range strings.Split(sseNewlines(data), "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteByte('\n')
+	return c.writeEventStream(buf.Bytes())
+}
+
+// SSEComment sends a comment line, which clients ignore. Comments keep
+// proxies from closing an idle stream.
+func (c *Context) SSEComment(text string) error {
+	return c.writeEventStream([]byte(": " + sseField(text) + "\n\n"))
+}
+
+// SSEStream sends the events received on events until the channel is
+// closed or the client disconnects, with a comment every heartbeat while
+// idle (0 disables them). It reports whether the client disconnected.
+func (c *Context) SSEStream(events <-chan ServerEvent, heartbeat time.Duration) bool {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	if heartbeat > 0 {
+		ticker = time.NewTicker(heartbeat)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	// 先发出响应头, 客户端马上就能知道连接已经建立
+	c.setEventStreamHeaders()
+	c.Writer.Flush()
+
+	done := c.Req.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			if err := c.SendEvent(ev); err != nil {
+				// 数据无法编码, 或者客户端已经断开 (下一轮由 done 返回)
+				c.Error(err)
+			}
+			if ticker != nil {
+				ticker.Reset(heartbeat)
+			}
+		case <-tick:
+			c.SSEComment("heartbeat")
+		}
+	}
+}
+
+func (c *Context) setEventStreamHeaders() {
+	if c.Writer.Written() {
+		return
+	}
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// 关闭 nginx 的响应缓冲
+	header.Set("X-Accel-Buffering", "no")
+}
+
+func (c *Context) writeEventStream(data []byte) error {
+	c.setEventStreamHeaders()
+	if _, err := c.Writer.Write(data); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// streamWriter serializes the writes of a Stream step with the heartbeat
+type streamWriter struct {
+	ResponseWriter
+	mu sync.Mutex
+	// events is set once the step wrote a text/event-stream body, idle
+	// when nothing was written since the last tick and boundary when the
+	// last write ended an event
+	events, idle, boundary bool
+}
+
+func (w *streamWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.events {
+		w.events = strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	w.idle = false
+	w.boundary = bytes.HasSuffix(data, []byte("\n\n"))
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *streamWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *streamWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *streamWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.Flush()
+}
+
+func (w *streamWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
+
+func (w *streamWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *streamWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+// heartbeat sends a comment when nothing was written for a whole tick.
+// It only does so between two events of an event stream, a comment
+// anywhere else would corrupt the body.
+func (w *streamWriter) heartbeat() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.idle && w.events && w.boundary {
+		w.ResponseWriter.Write([]byte(": heartbeat\n\n"))
+		w.ResponseWriter.Flush()
+	}
+	w.idle = true
+}
+
+// sseField drops line breaks, which would end the field early
+var sseField = strings.NewReplacer("\r", "", "\n", "").Replace
+
+// sseNewlines turns the line endings of the format (\r\n, \r and \n) into \n
+var sseNewlines = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace
@@ -0,0 +1,173 @@
+package gee
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads the lines of one event, up to the empty line ending it
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("stream ended early: %v, read %q", err, lines)
+		}
+		if line == "\n" {
+			return strings.Join(lines, "")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestSSEStream(t *testing.T) {
+	events := make(chan ServerEvent)
+	disconnected := make(chan bool, 1)
+
+	r := New()
+	r.GET("/events", func(c *Context) {
+		disconnected <- c.SSEStream(events, 200*time.Millisecond)
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	body := bufio.NewReader(resp.Body)
+
+	// 每个事件在下一个事件发送之前就能读到
+	events <- ServerEvent{Event: "update", ID: "1", Data: H{"cpu": 42}}
+	if got := readEvent(t, body); got != "event: update\nid: 1\ndata: {\"cpu\":42}\n" {
+		t.Errorf("unexpected first event %q", got)
+	}
+	events <- ServerEvent{Data: "line 1\nline 2"}
+	if got := readEvent(t, body); got != "data: line 1\ndata: line 2\n" {
+		t.Errorf("unexpected second event %q", got)
+	}
+	// 单独的 \r 也是换行, 不能借它伪造出 event, id 或 retry 字段
+	events <- ServerEvent{Event: "x\rid: 2", ID: "1\nretry: 1", Data: "a\revent: admin\r\nb"}
+	if got := readEvent(t, body); got != "event: xid: 2\nid: 1retry: 1\ndata: a\ndata: event: admin\ndata: b\n" {
+		t.Errorf("unexpected third event %q", got)
+	}
+
+	// 空闲时发送心跳注释
+	if got := readEvent(t, body); got != ": heartbeat\n" {
+		t.Errorf("expected a heartbeat, got %q", got)
+	}
+
+	cancel()
+	select {
+	case gone := <-disconnected:
+		if !gone {
+			t.Error("SSEStream should report the client disconnect")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SSEStream did not return after the client disconnected")
+	}
+}
+
+func TestStream(t *testing.T) {
+	r := New()
+	r.GET("/count", func(c *Context) {
+		i := 0
+		c.Stream(func(w io.Writer) bool {
+			i++
+			c.SSEvent("count", i)
+			return i < 3
+		})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/count", nil))
+	expected := "event: count\ndata: 1\n\nevent: count\ndata: 2\n\nevent: count\ndata: 3\n\n"
+	if w.Body.String() != expected {
+		t.Errorf("expected %q, got %q", expected, w.Body.String())
+	}
+	if !w.Flushed {
+		t.Error("stream was not flushed")
+	}
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	next := make(chan string, 1)
+	disconnected := make(chan bool, 1)
+
+	r := New()
+	r.StreamHeartbeat = 50 * time.Millisecond
+	r.GET("/ticks", func(c *Context) {
+		disconnected <- c.Stream(func(w io.Writer) bool {
+			select {
+			case data := <-next:
+				c.SSEvent("tick", data)
+				return true
+			case <-c.Req.Context().Done():
+				return false
+			}
+		})
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/ticks", nil)
+	// 响应头随第一个事件发出
+	next <- "1"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+
+	if got := readEvent(t, body); got != "event: tick\ndata: 1\n" {
+		t.Errorf("unexpected event %q", got)
+	}
+	// step 阻塞等待数据时照样发出心跳
+	if got := readEvent(t, body); got != ": heartbeat\n" {
+		t.Errorf("expected a heartbeat, got %q", got)
+	}
+	next <- "2"
+	if got := readEvent(t, body); got != "event: tick\ndata: 2\n" {
+		t.Errorf("unexpected event %q", got)
+	}
+
+	cancel()
+	select {
+	case gone := <-disconnected:
+		if !gone {
+			t.Error("Stream should report the client disconnect")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Stream did not return after the client disconnected")
+	}
+}
+
+func TestStreamPanic(t *testing.T) {
+	r := New()
+	r.Use(Recovery())
+	r.GET("/panic", func(c *Context) {
+		c.Stream(func(w io.Writer) bool { panic("step failed") })
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("a panic in step should reach Recovery, got %d", w.Code)
+	}
+}
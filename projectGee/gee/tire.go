@@ -1,68 +1,198 @@
 package gee
 
 import (
+	"fmt"
 	"strings"
 )
 
+/*
+压缩前缀树 (radix tree)
+
+	GET /hello/:name   GET /hello/b/c   GET /hi/:name   GET /assets/*filepath
+
+	/
+	├── h
+	│   ├── ello/          -> :name
+	│   │   └── b/c
+	│   └── i/             -> :name
+	└── assets/            -> *filepath
+
+静态路径按公共前缀压缩, 子节点用首字节 (indices) 索引;
+:param 与 *catchall 挂在单独的位置, 匹配优先级: 静态 > :param > *catchall
+*/
+
+type nodeType uint8
+
+const (
+	staticNode   nodeType = iota // 静态前缀, 可以跨越多个 segment
+	paramNode                    // :name, 匹配一个 segment
+	catchAllNode                 // *name, 匹配剩余的所有 segment
+)
+
+// param is a matched wildcard, collected into a reusable slice on lookup
+type param struct {
+	key   string
+	value string
+}
+
 type node struct {
-	pattern  string
-	part     string
-	children []*node
-	isWild   bool
+	path     string // static prefix, ":name" or "*name"
+	pattern  string // the registered route ending here, "" if none
+	kind     nodeType
+	indices  string  // first byte of every static child
+	children []*node // static children, in the same order as indices
+	wild     *node   // :param child
+	catchAll *node   // *catchall child
+	route    *route
 }
 
-func (n *node) matchChild(part string) *node {
+// anyPattern returns a route registered in the subtree rooted at n
+func (n *node) anyPattern() string {
+	if n.pattern != "" {
+		return n.pattern
+	}
 	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			return child
+		if p := child.anyPattern(); p != "" {
+			return p
+		}
+	}
+	for _, child := range []*node{n.wild, n.catchAll} {
+		if child != nil {
+			if p := child.anyPattern(); p != "" {
+				return p
+			}
 		}
 	}
 
-	return nil
+	return ""
 }
 
-func (n *node) matchChildren(part string) []*node {
-	nodes := make([]*node, 0)
-	for _, child := range n.children {
-		if child.part == part || child.isWild {
-			nodes = append(nodes, child)
+func longestCommonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// insertStatic walks (and splits when needed) the static children of n
+// along s, returning the node where s ends
+func (n *node) insertStatic(s string) *node {
+	for len(s) > 0 {
+		i := strings.IndexByte(n.indices, s[0])
+		if i < 0 {
+			child := &node{path: s, kind: staticNode}
+			n.indices += s[:1]
+			n.children = append(n.children, child)
+			return child
 		}
+
+		child := n.children[i]
+		l := longestCommonPrefix(s, child.path)
+		if l < len(child.path) {
+			// split: child 只保留公共前缀之后的部分
+			split := &node{
+				path:     child.path[:l],
+				kind:     staticNode,
+				indices:  child.path[l : l+1],
+				children: []*node{child},
+			}
+			child.path = child.path[l:]
+			n.children[i] = split
+			child = split
+		}
+		s = s[l:]
+		n = child
 	}
 
-	return nodes
+	return n
 }
 
-func (n *node) insert(pattern string, parts []string, height int) {
-	if len(parts) == height {
-		n.pattern = pattern
-		return
+// insertWild returns the wildcard child of n for part, creating it if needed
+func (n *node) insertWild(pattern string, part string) (*node, error) {
+	slot, kind := &n.wild, paramNode
+	if part[0] == '*' {
+		slot, kind = &n.catchAll, catchAllNode
+	}
+	if *slot == nil {
+		*slot = &node{path: part, kind: kind}
+	} else if (*slot).path != part {
+		return nil, fmt.Errorf("%s conflicts with existing route %s: '%s' is ambiguous with '%s'",
+			pattern, (*slot).anyPattern(), part, (*slot).path)
+	}
+
+	return *slot, nil
+}
+
+// insert adds pattern, already split by parsePattern, below the root n
+func (n *node) insert(pattern string, parts []string, r *route) error {
+	cur := n
+	prefix := "/"
+	for _, part := range parts {
+		if part[0] != ':' && part[0] != '*' {
+			prefix += part + "/"
+			continue
+		}
+		cur = cur.insertStatic(prefix)
+		prefix = "/"
+
+		var err error
+		if cur, err = cur.insertWild(pattern, part); err != nil {
+			return err
+		}
+	}
+	if len(parts) > 0 {
+		prefix = prefix[:len(prefix)-1]
 	}
+	cur = cur.insertStatic(prefix)
 
-	part := parts[height]
-	child := n.matchChild(part)
-	if child == nil {
-		child = &node{part: part, isWild: part[0] == ':' || part[0] == '*'}
-		n.children = append(n.children, child)
+	if cur.pattern != "" {
+		return fmt.Errorf("%s conflicts with existing route %s", pattern, cur.pattern)
 	}
-	child.insert(pattern, parts, height+1)
+	cur.pattern = pattern
+	cur.route = r
+	return nil
 }
 
-func (n *node) search(parts []string, height int) *node {
-	if len(parts) == height || strings.HasPrefix(n.part, "*") {
+// search matches path, with the part belonging to n already consumed.
+// Wildcards are appended to ps and removed again when backtracking, so a
+// lookup with a preallocated ps does not allocate.
+func (n *node) search(path string, ps *[]param) *node {
+	if path == "" {
 		if n.pattern == "" {
 			return nil
 		}
 		return n
 	}
 
-	part := parts[height]
-	children := n.matchChildren(part)
+	if i := strings.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.path) {
+			if result := child.search(path[len(child.path):], ps); result != nil {
+				return result
+			}
+		}
+	}
+
+	if n.wild != nil {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			*ps = append(*ps, param{key: n.wild.path[1:], value: path[:end]})
+			if result := n.wild.search(path[end:], ps); result != nil {
+				return result
+			}
+			*ps = (*ps)[:len(*ps)-1]
+		}
+	}
 
-	for _, child := range children {
-		result := child.search(parts, height+1)
-		if result != nil {
-			return result
+	if n.catchAll != nil && n.catchAll.pattern != "" {
+		if key := n.catchAll.path[1:]; key != "" {
+			*ps = append(*ps, param{key: key, value: path})
 		}
+		return n.catchAll
 	}
 
 	return nil
@@ -0,0 +1,153 @@
+package gee
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// maxMultipartMemory returns Engine.MaxMultipartMemory
+func (c *Context) maxMultipartMemory() int64 {
+	if c.engine != nil && c.engine.MaxMultipartMemory > 0 {
+		return c.engine.MaxMultipartMemory
+	}
+	return defaultMultipartMemory
+}
+
+// MultipartForm parses the multipart form, keeping up to
+// Engine.MaxMultipartMemory bytes in memory
+func (c *Context) MultipartForm() (*multipart.Form, error) {
+	if err := c.Req.ParseMultipartForm(c.maxMultipartMemory()); err != nil {
+		return nil, err
+	}
+	return c.Req.MultipartForm, nil
+}
+
+// FormFile returns the first uploaded file for name
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if c.Req.MultipartForm == nil {
+		if _, err := c.MultipartForm(); err != nil {
+			return nil, err
+		}
+	}
+	f, fh, err := c.Req.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return fh, nil
+}
+
+// SaveUploadedFile writes an uploaded file to dst. When dst is an existing
+// directory the file is stored inside it under SanitizeFilename(fh.Filename),
+// otherwise dst is used as the file path.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		name := SanitizeFilename(fh.Filename)
+		if name == "" {
+			return fmt.Errorf("gee: invalid upload file name %q", fh.Filename)
+		}
+		dir := filepath.Clean(dst)
+		dst = filepath.Join(dir, name)
+		// 再确认一次结果仍然在目标目录下
+		if filepath.Dir(dst) != dir {
+			return fmt.Errorf("gee: upload file name %q escapes %s", fh.Filename, dir)
+		}
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SanitizeFilename reduces a client supplied file name to a safe base name:
+// directories, control and reserved characters are dropped. It returns ""
+// when nothing usable is left, e.g. for "..".
+func SanitizeFilename(name string) string {
+	// 客户端可能发来 Windows 风格的路径
+	name = strings.ReplaceAll(name, "\\", "/")
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`<>:"|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || strings.Trim(name, ".") == "" {
+		return ""
+	}
+	return name
+}
+
+// BodyLimit rejects request bodies larger than limit bytes with 413.
+// Bodies with a known length are rejected before the handler runs, others
+// fail to read past the limit: binding and multipart helpers then return
+// an *http.MaxBytesError, which Context.Fail renders as 413, and a response
+// left unwritten by the handler is answered with 413 as well.
+func BodyLimit(limit int64) HandlerFunc {
+	return func(c *Context) {
+		if c.Req.ContentLength > limit {
+			c.Fail(http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		if c.Req.Body == nil {
+			c.Next()
+			return
+		}
+
+		body := &limitedBody{ReadCloser: http.MaxBytesReader(c.Writer, c.Req.Body, limit)}
+		c.Req.Body = body
+		c.Next()
+		if body.exceeded && !c.Writer.Written() {
+			c.Fail(http.StatusRequestEntityTooLarge, "request body too large")
+		}
+	}
+}
+
+// limitedBody records whether a read hit the limit of http.MaxBytesReader
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// BodyLimit limits the request body of the route to limit bytes, see BodyLimit
+func (r *Route) BodyLimit(limit int64) *Route {
+	for _, rt := range r.routes {
+		rt.bodyLimit = limit
+		r.engine.compile(rt)
+	}
+	return r
+}
@@ -0,0 +1,133 @@
+package gee
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := map[string]string{
+		"avatar.png":            "avatar.png",
+		"../../etc/passwd":      "passwd",
+		`..\..\windows\win.ini`: "win.ini",
+		"a\x00b<c>.txt":         "abc.txt",
+		"..":                    "",
+		"dir/":                  "",
+		"  ":                    "",
+	}
+	for name, expected := range tests {
+		if got := SanitizeFilename(name); got != expected {
+			t.Errorf("SanitizeFilename(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func multipartRequest(t *testing.T, target, filename, content string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestSaveUploadedFile(t *testing.T) {
+	dir := t.TempDir()
+	r := New()
+	r.POST("/upload", func(c *Context) {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.Fail(http.StatusBadRequest, err)
+			return
+		}
+		if err := c.SaveUploadedFile(fh, dir); err != nil {
+			c.Fail(http.StatusBadRequest, err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	// multipart 本身会去掉目录, 这里直接构造带 ".." 的文件名
+	req := multipartRequest(t, "/upload", "x", "hello")
+	req.Body = io.NopCloser(strings.NewReader(strings.Replace(readAll(t, req.Body), `filename="x"`, `filename="..\..\evil.txt"`, 1)))
+	req.ContentLength = -1
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "evil.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("file should be stored inside the destination directory: %v", err)
+	}
+}
+
+func readAll(t *testing.T, r io.Reader) string {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBodyLimit(t *testing.T) {
+	r := New()
+	r.MaxMultipartMemory = 1 << 10
+	upload := func(c *Context) {
+		if _, err := c.FormFile("file"); err != nil {
+			c.Fail(http.StatusBadRequest, err)
+			return
+		}
+		c.String(http.StatusOK, "ok")
+	}
+	r.POST("/upload", upload).BodyLimit(512)
+	r.POST("/unlimited", upload)
+	r.POST("/partial", func(c *Context) {
+		c.Writer.Write([]byte("partial"))
+		io.ReadAll(c.Req.Body)
+	}).BodyLimit(512)
+
+	big := strings.Repeat("x", 1024)
+	tests := []struct {
+		target  string
+		chunked bool
+		code    int
+	}{
+		{"/upload", false, http.StatusRequestEntityTooLarge},
+		{"/upload", true, http.StatusRequestEntityTooLarge},
+		{"/unlimited", false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := multipartRequest(t, tt.target, "big.txt", big)
+		if tt.chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code {
+			t.Errorf("%s (chunked %v): expected %d, got %d", tt.target, tt.chunked, tt.code, w.Code)
+		}
+	}
+
+	// 响应已经开始写了, 不再追加 413
+	req := httptest.NewRequest("POST", "/partial", strings.NewReader(big))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("expected the partial body alone, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,413 @@
+package gee
+
+/*
+validation: 绑定之后按 `validate` 标签校验结构体
+
+	type SignUp struct {
+		Name  string `json:"name" validate:"required,min=3,max=64"`
+		Email string `json:"email" validate:"required,email"`
+		Role  string `json:"role" validate:"omitempty,oneof=admin user"`
+	}
+
+规则之间用 ',' 分隔, 参数写在 '=' 之后; 嵌套的结构体 (以及结构体切片) 会递归校验.
+自定义规则通过 RegisterValidation 注册, 也可以替换 Engine.Validator 接入其他校验库.
+
+标签写错 (未知规则, min=abc...) 时校验返回 *RuleError 而不是 panic; 在启动时调用 Check
+可以提前发现:
+
+	if err := gee.DefaultValidator.Check(SignUp{}); err != nil {
+		log.Fatal(err)
+	}
+*/
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Validator validates bound structs, see Engine.Validator
+type Validator interface {
+	ValidateStruct(obj interface{}) error
+}
+
+// ValidationFunc checks field against the parameter of the rule, e.g. "3"
+// for min=3. The returned error becomes the message of the FieldError.
+type ValidationFunc func(field reflect.Value, param string) error
+
+// FieldError is a field that failed a validation rule
+type FieldError struct {
+	Field   string `json:"field"` // path of the struct field, e.g. "Items[0].Name"
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationErrors collects every failed field of a struct
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// RuleError is a `validate` tag that cannot be run, a mistake in the
+// struct definition rather than in the request
+type RuleError struct {
+	Field string
+	Rule  string
+	Param string
+	Err   error
+}
+
+func (e *RuleError) Error() string {
+	rule := e.Rule
+	if e.Param != "" {
+		rule += "=" + e.Param
+	}
+	return fmt.Sprintf("gee: invalid validation rule %q on %s: %v", rule, e.Field, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// TagValidator is the default Validator driven by `validate` tags
+type TagValidator struct {
+	mu      sync.RWMutex
+	rules   map[string]ValidationFunc
+	checked sync.Map // reflect.Type -> error of Check, nil when valid
+}
+
+// DefaultValidator is used by engines unless Engine.Validator is replaced
+var DefaultValidator = NewTagValidator()
+
+// NewTagValidator returns a TagValidator with the built-in rules
+func NewTagValidator() *TagValidator {
+	v := &TagValidator{rules: make(map[string]ValidationFunc)}
+	for name, fn := range builtinRules {
+		v.rules[name] = fn
+	}
+	return v
+}
+
+// RegisterValidation adds a custom rule to DefaultValidator
+func RegisterValidation(name string, fn ValidationFunc) {
+	DefaultValidator.RegisterValidation(name, fn)
+}
+
+// RegisterValidation adds a custom rule, replacing any rule with the same name
+func (v *TagValidator) RegisterValidation(name string, fn ValidationFunc) {
+	if name == "" || name == "omitempty" || fn == nil {
+		panic("gee: invalid validation rule " + name)
+	}
+	v.mu.Lock()
+	v.rules[name] = fn
+	v.mu.Unlock()
+	// 之前因为缺少这条规则而失败的检查需要重新做
+	v.checked.Range(func(key, _ interface{}) bool {
+		v.checked.Delete(key)
+		return true
+	})
+}
+
+// Check reports the first `validate` tag of obj, a struct or a pointer to
+// one, that names an unknown rule or has an invalid parameter. Nested
+// structs are checked too.
+func (v *TagValidator) Check(obj interface{}) error {
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	return v.checkType(t)
+}
+
+// checkType is Check, cached per type
+func (v *TagValidator) checkType(t reflect.Type) error {
+	if cached, ok := v.checked.Load(t); ok {
+		err, _ := cached.(error)
+		return err
+	}
+	err := v.checkStruct(t, "", map[reflect.Type]bool{})
+	v.checked.Store(t, err)
+	return err
+}
+
+func (v *TagValidator) checkStruct(t reflect.Type, prefix string, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		path := prefix + sf.Name
+		if sf.Anonymous {
+			path = strings.TrimSuffix(prefix, ".")
+		}
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, rule := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+				if err := v.checkRule(name, param); err != nil {
+					return &RuleError{Field: path, Rule: name, Param: param, Err: err}
+				}
+			}
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice || ft.Kind() == reflect.Array {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType {
+			next := path
+			if next != "" {
+				next += "."
+			}
+			if err := v.checkStruct(ft, next, seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *TagValidator) checkRule(name, param string) error {
+	if name == "omitempty" {
+		return nil
+	}
+	v.mu.RLock()
+	_, ok := v.rules[name]
+	v.mu.RUnlock()
+	if !ok {
+		return errors.New("unknown rule")
+	}
+	if numericRules[name] {
+		if _, err := strconv.ParseFloat(param, 64); err != nil {
+			return errors.New("parameter must be a number")
+		}
+	}
+	return nil
+}
+
+// numericRules are the built-in rules that take a number, see compare
+var numericRules = map[string]bool{"min": true, "max": true, "len": true, "gt": true, "lt": true}
+
+// ValidateStruct validates obj, a struct or a pointer to one, and returns
+// ValidationErrors when any rule fails. A broken tag is returned as a
+// *RuleError before any rule runs, see Check.
+func (v *TagValidator) ValidateStruct(obj interface{}) error {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	if err := v.checkType(rv.Type()); err != nil {
+		return err
+	}
+
+	var errs ValidationErrors
+	v.validateStruct(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (v *TagValidator) validateStruct(rv reflect.Value, prefix string, errs *ValidationErrors) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		field := rv.Field(i)
+		path := prefix + sf.Name
+		if sf.Anonymous {
+			path = strings.TrimSuffix(prefix, ".")
+		}
+
+		if tag := sf.Tag.Get("validate"); tag != "" && tag != "-" {
+			if !v.validateField(field, path, tag, errs) {
+				continue
+			}
+		}
+		v.dive(field, path, errs)
+	}
+}
+
+// dive validates nested structs, through pointers and slices
+func (v *TagValidator) dive(field reflect.Value, path string, errs *ValidationErrors) {
+	for field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return
+		}
+		field = field.Elem()
+	}
+
+	switch field.Kind() {
+	case reflect.Struct:
+		if field.Type() == timeType {
+			return
+		}
+		if path != "" {
+			path += "."
+		}
+		v.validateStruct(field, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			v.dive(field.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+}
+
+// validateField runs the rules in tag and reports whether all passed
+func (v *TagValidator) validateField(field reflect.Value, path string, tag string, errs *ValidationErrors) bool {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "omitempty" {
+			if field.IsZero() {
+				return true
+			}
+			continue
+		}
+
+		// checkType 已经确认过规则存在
+		v.mu.RLock()
+		fn := v.rules[name]
+		v.mu.RUnlock()
+		if err := fn(field, param); err != nil {
+			*errs = append(*errs, &FieldError{Field: path, Rule: name, Param: param, Message: err.Error()})
+			return false
+		}
+	}
+	return true
+}
+
+var builtinRules = map[string]ValidationFunc{
+	"required": func(field reflect.Value, _ string) error {
+		if field.IsZero() || (field.Kind() == reflect.Slice || field.Kind() == reflect.Map) && field.Len() == 0 {
+			return errors.New("is required")
+		}
+		return nil
+	},
+	"min": func(field reflect.Value, param string) error {
+		return compare(field, param, func(n, limit float64) bool { return n >= limit }, "at least")
+	},
+	"max": func(field reflect.Value, param string) error {
+		return compare(field, param, func(n, limit float64) bool { return n <= limit }, "at most")
+	},
+	"len": func(field reflect.Value, param string) error {
+		return compare(field, param, func(n, limit float64) bool { return n == limit }, "exactly")
+	},
+	"gt": func(field reflect.Value, param string) error {
+		return compare(field, param, func(n, limit float64) bool { return n > limit }, "greater than")
+	},
+	"lt": func(field reflect.Value, param string) error {
+		return compare(field, param, func(n, limit float64) bool { return n < limit }, "less than")
+	},
+	"oneof": func(field reflect.Value, param string) error {
+		value := fmt.Sprint(deref(field).Interface())
+		for _, option := range strings.Fields(param) {
+			if value == option {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of [%s]", param)
+	},
+	"email": func(field reflect.Value, _ string) error {
+		value := deref(field).String()
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return errors.New("must be a valid email address")
+		}
+		return nil
+	},
+	"url": func(field reflect.Value, _ string) error {
+		if u, err := url.Parse(deref(field).String()); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.New("must be a valid URL")
+		}
+		return nil
+	},
+	"alpha": func(field reflect.Value, _ string) error {
+		return eachRune(field, unicode.IsLetter, "must contain only letters")
+	},
+	"alphanum": func(field reflect.Value, _ string) error {
+		return eachRune(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }, "must contain only letters and digits")
+	},
+	"numeric": func(field reflect.Value, _ string) error {
+		if _, err := strconv.ParseFloat(deref(field).String(), 64); err != nil {
+			return errors.New("must be numeric")
+		}
+		return nil
+	},
+}
+
+func deref(field reflect.Value) reflect.Value {
+	for field.Kind() == reflect.Pointer && !field.IsNil() {
+		field = field.Elem()
+	}
+	return field
+}
+
+// compare checks numbers by value, and strings, slices and maps by length
+func compare(field reflect.Value, param string, ok func(n, limit float64) bool, relation string) error {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("gee: invalid validation parameter %q", param))
+	}
+
+	field = deref(field)
+	var n float64
+	unit := ""
+	switch field.Kind() {
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(field.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, unit = float64(field.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = field.Float()
+	default:
+		return errors.New("cannot be compared")
+	}
+
+	if !ok(n, limit) {
+		return fmt.Errorf("must be %s %s%s", relation, param, unit)
+	}
+	return nil
+}
+
+func eachRune(field reflect.Value, ok func(r rune) bool, message string) error {
+	for _, r := range deref(field).String() {
+		if !ok(r) {
+			return errors.New(message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,691 @@
+package gee
+
+/*
+WebSocket (RFC 6455), 只依赖 net/http 的 Hijacker
+
+	api := r.Group("/api")
+	api.Use(auth) // 分组中间件在握手之前执行, 可以直接拒绝请求
+	api.WS("/chat", func(c *gee.Context, ws *gee.WebSocket) {
+		for {
+			typ, msg, err := ws.ReadMessage()
+			if err != nil {
+				return // 对方关闭或者连接出错
+			}
+			ws.WriteMessage(typ, msg)
+		}
+	})
+
+ReadMessage 会自动应答 ping, 拼接分片消息, 并完成关闭握手; 同一时间只能有一个 goroutine 读,
+写可以在多个 goroutine 中进行.
+*/
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, the opcodes of RFC 6455
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005 // no code in the close frame, never sent
+	CloseAbnormalClosure         = 1006 // connection lost without close frame, never sent
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const (
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// defaultMaxMessageSize is the read limit when none is configured
+	defaultMaxMessageSize = 1 << 20
+	// closeTimeout bounds the wait for the close frame of the peer
+	closeTimeout   = 5 * time.Second
+	opContinuation = 0
+)
+
+// ErrCloseSent is returned when writing after the close frame was sent
+var ErrCloseSent = errors.New("gee: websocket close frame already sent")
+
+// CloseError is returned by ReadMessage once the connection is closed.
+// Code is the code of the close frame, CloseAbnormalClosure when the
+// connection was lost.
+type CloseError struct {
+	Code int
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("gee: websocket closed (%d)", e.Code)
+	}
+	return fmt.Sprintf("gee: websocket closed (%d): %s", e.Code, e.Text)
+}
+
+// IsCloseError reports whether err is a CloseError with one of codes,
+// or any CloseError when no code is given
+func IsCloseError(err error, codes ...int) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// WebSocketConfig configures Context.Upgrade, see Engine.WebSocket
+type WebSocketConfig struct {
+	// MaxMessageSize is the largest message ReadMessage accepts, 1 MB by
+	// default. Bigger messages close the connection with 1009.
+	MaxMessageSize int64
+	// CheckOrigin accepts or rejects the handshake with 403. By default
+	// browsers may only connect from the same host.
+	CheckOrigin func(r *http.Request) bool
+	// Subprotocols are the supported subprotocols by preference, the first
+	// one also offered by the client is selected
+	Subprotocols []string
+}
+
+// WebSocketHandler serves an upgraded connection, see RouteGroup.WS
+type WebSocketHandler func(c *Context, ws *WebSocket)
+
+// WS registers a GET route upgrading to WebSocket. The group middleware
+// runs before the upgrade, the connection is closed when handler returns.
+func (group *RouteGroup) WS(pattern string, handler WebSocketHandler) *Route {
+	return group.GET(pattern, func(c *Context) {
+		ws, err := c.Upgrade()
+		if err != nil {
+			// Upgrade 已经写好了错误响应
+			return
+		}
+		defer ws.Close()
+		handler(c, ws)
+	})
+}
+
+// WebSocket is a server side WebSocket connection
+type WebSocket struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	bw          *bufio.Writer
+	subprotocol string
+	readLimit   int64
+
+	msgMu     sync.Mutex // one data message at a time, see NextWriter
+	frameMu   sync.Mutex // one frame at a time, control frames go between fragments
+	closeSent bool       // guarded by frameMu
+
+	readMu      sync.Mutex // one reader at a time, Close drains through it when free
+	readErr     error      // sticky read error, guarded by readMu
+	pongHandler func(data []byte) error
+}
+
+// Upgrade performs the WebSocket handshake and takes over the connection.
+// When the request is no valid handshake the error response is written
+// and an error returned.
+func (c *Context) Upgrade() (*WebSocket, error) {
+	var config WebSocketConfig
+	if c.engine != nil {
+		config = c.engine.WebSocket
+	}
+	fail := func(code int, message string) (*WebSocket, error) {
+		c.String(code, "%s\n", message)
+		return nil, errors.New("gee: websocket handshake: " + message)
+	}
+
+	req := c.Req
+	if req.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "method is not GET")
+	}
+	if !headerHasToken(req.Header, "Connection", "upgrade") || !headerHasToken(req.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		c.SetHeader("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	checkOrigin := config.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return fail(http.StatusForbidden, "origin not allowed")
+	}
+	subprotocol := selectSubprotocol(req, config.Subprotocols)
+
+	conn, brw, err := c.Writer.Hijack()
+	if err != nil {
+		return fail(http.StatusInternalServerError, "connection cannot be hijacked")
+	}
+	// http.Server 的超时设置在连接上, 接管之后需要清除
+	conn.SetDeadline(time.Time{})
+	// 访问日志里记录 101
+	c.writer.status = http.StatusSwitchingProtocols
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	// 中间件设置的响应头 (例如 Set-Cookie) 一起发出
+	for name, values := range c.Writer.Header() {
+		if upgradeSkippedHeaders[name] {
+			continue
+		}
+		for _, value := range values {
+			if !strings.ContainsAny(value, "\r\n") {
+				b.WriteString(name + ": " + value + "\r\n")
+			}
+		}
+	}
+	b.WriteString("\r\n")
+	if _, err := brw.WriteString(b.String()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	limit := config.MaxMessageSize
+	if limit <= 0 {
+		limit = defaultMaxMessageSize
+	}
+	return &WebSocket{
+		conn:        conn,
+		br:          brw.Reader,
+		bw:          brw.Writer,
+		subprotocol: subprotocol,
+		readLimit:   limit,
+	}, nil
+}
+
+// upgradeSkippedHeaders are not copied into the 101 response: they
+// describe a body or the connection, or are written by Upgrade itself
+var upgradeSkippedHeaders = map[string]bool{
+	"Content-Type":             true,
+	"Content-Length":           true,
+	"Content-Encoding":         true,
+	"Content-Range":            true,
+	"Transfer-Encoding":        true,
+	"Trailer":                  true,
+	"Vary":                     true,
+	"Connection":               true,
+	"Keep-Alive":               true,
+	"Proxy-Connection":         true,
+	"Te":                       true,
+	"Upgrade":                  true,
+	"Sec-Websocket-Accept":     true,
+	"Sec-Websocket-Protocol":   true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Version":    true,
+}
+
+// headerHasToken reports whether the comma separated header contains token
+func headerHasToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin accepts requests without Origin, which do not come from a browser
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	for _, s := range supported {
+		if headerHasToken(r.Header, "Sec-WebSocket-Protocol", s) {
+			return s
+		}
+	}
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// Subprotocol returns the negotiated subprotocol, "" if none
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the address of the client
+func (ws *WebSocket) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadLimit sets the largest message ReadMessage accepts
+func (ws *WebSocket) SetReadLimit(limit int64) {
+	ws.readLimit = limit
+}
+
+// SetReadDeadline makes reads fail after t, e.g. to drop clients that stop
+// answering pings. The zero time disables it.
+func (ws *WebSocket) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline makes writes fail after t, the zero time disables it
+func (ws *WebSocket) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler sets the function called by ReadMessage for pong frames,
+// an error returned by it is returned by ReadMessage
+func (ws *WebSocket) SetPongHandler(h func(data []byte) error) {
+	ws.pongHandler = h
+}
+
+// frameHeader is a parsed frame header, mask is only set by clients
+type frameHeader struct {
+	fin    bool
+	opcode int
+	length int64
+	mask   [4]byte
+}
+
+// ReadMessage returns the next text or binary message, joining fragments.
+// Pings are answered and a close frame is echoed, ReadMessage then returns
+// a *CloseError. After an error the connection is unusable.
+func (ws *WebSocket) ReadMessage() (messageType int, data []byte, err error) {
+	ws.readMu.Lock()
+	defer ws.readMu.Unlock()
+	return ws.readMessage()
+}
+
+// readMessage is ReadMessage, the caller holds readMu
+func (ws *WebSocket) readMessage() (messageType int, data []byte, err error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+
+	for {
+		h, err := ws.readFrameHeader()
+		if err != nil {
+			return 0, nil, ws.readFailed(err)
+		}
+
+		if h.opcode >= CloseMessage {
+			payload, err := ws.readPayload(h, nil)
+			if err != nil {
+				return 0, nil, ws.readFailed(err)
+			}
+			if err := ws.handleControl(h.opcode, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+
+		switch {
+		case h.opcode == opContinuation && messageType == 0:
+			return 0, nil, ws.protocolError(CloseProtocolError, "continuation frame without a message")
+		case h.opcode != opContinuation && messageType != 0:
+			return 0, nil, ws.protocolError(CloseProtocolError, "new message inside a fragmented message")
+		case h.opcode != opContinuation:
+			messageType = h.opcode
+		}
+		if int64(len(data))+h.length > ws.readLimit {
+			return 0, nil, ws.protocolError(CloseMessageTooBig, "message exceeds the read limit")
+		}
+		if data, err = ws.readPayload(h, data); err != nil {
+			return 0, nil, ws.readFailed(err)
+		}
+		if h.fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, ws.protocolError(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+			}
+			return messageType, data, nil
+		}
+	}
+}
+
+func (ws *WebSocket) readFrameHeader() (frameHeader, error) {
+	var h frameHeader
+	var b [8]byte
+	if _, err := io.ReadFull(ws.br, b[:2]); err != nil {
+		return h, err
+	}
+	h.fin = b[0]&0x80 != 0
+	h.opcode = int(b[0] & 0x0f)
+	if b[0]&0x70 != 0 {
+		// 没有协商任何扩展, RSV 位必须为 0
+		return h, ws.protocolError(CloseProtocolError, "reserved bits set")
+	}
+	switch h.opcode {
+	case opContinuation, TextMessage, BinaryMessage:
+	case CloseMessage, PingMessage, PongMessage:
+		if !h.fin {
+			return h, ws.protocolError(CloseProtocolError, "fragmented control frame")
+		}
+	default:
+		return h, ws.protocolError(CloseProtocolError, fmt.Sprintf("unknown opcode %d", h.opcode))
+	}
+	if b[1]&0x80 == 0 {
+		return h, ws.protocolError(CloseProtocolError, "unmasked client frame")
+	}
+
+	h.length = int64(b[1] & 0x7f)
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(ws.br, b[:2]); err != nil {
+			return h, err
+		}
+		h.length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.br, b[:8]); err != nil {
+			return h, err
+		}
+		n := binary.BigEndian.Uint64(b[:8])
+		if n > 1<<63-1 {
+			return h, ws.protocolError(CloseProtocolError, "invalid frame length")
+		}
+		h.length = int64(n)
+	}
+	if h.opcode >= CloseMessage && h.length > 125 {
+		return h, ws.protocolError(CloseProtocolError, "control frame too long")
+	}
+	if _, err := io.ReadFull(ws.br, h.mask[:]); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// readPayload appends the unmasked payload of h to buf
+func (ws *WebSocket) readPayload(h frameHeader, buf []byte) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, make([]byte, h.length)...)
+	if _, err := io.ReadFull(ws.br, buf[start:]); err != nil {
+		return nil, err
+	}
+	for i := range buf[start:] {
+		buf[start+i] ^= h.mask[i%4]
+	}
+	return buf, nil
+}
+
+func (ws *WebSocket) handleControl(opcode int, payload []byte) error {
+	switch opcode {
+	case PingMessage:
+		if err := ws.writeFrame(PongMessage, true, payload); err != nil && err != ErrCloseSent {
+			return ws.readFailed(err)
+		}
+	case PongMessage:
+		if ws.pongHandler != nil {
+			if err := ws.pongHandler(payload); err != nil {
+				return err
+			}
+		}
+	case CloseMessage:
+		code, reason := CloseNoStatusReceived, ""
+		switch {
+		case len(payload) == 1:
+			return ws.protocolError(CloseProtocolError, "invalid close frame")
+		case len(payload) >= 2:
+			code = int(binary.BigEndian.Uint16(payload))
+			reason = string(payload[2:])
+			if !validCloseCode(code) {
+				return ws.protocolError(CloseProtocolError, "invalid close code")
+			}
+			if !utf8.ValidString(reason) {
+				return ws.protocolError(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason")
+			}
+		}
+		// 回应同样的 code 完成关闭握手
+		var echo []byte
+		if code != CloseNoStatusReceived {
+			echo = closePayload(code, "")
+		}
+		ws.writeFrame(CloseMessage, true, echo)
+		ws.conn.Close()
+		ws.readErr = &CloseError{Code: code, Text: reason}
+		return ws.readErr
+	}
+	return nil
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011, code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// protocolError closes the connection with code and makes it the read error
+func (ws *WebSocket) protocolError(code int, text string) error {
+	ws.writeFrame(CloseMessage, true, closePayload(code, text))
+	ws.conn.Close()
+	ws.readErr = &CloseError{Code: code, Text: text}
+	return ws.readErr
+}
+
+// readFailed records an I/O error, a lost connection becomes CloseAbnormalClosure
+func (ws *WebSocket) readFailed(err error) error {
+	if ws.readErr != nil {
+		return ws.readErr
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		err = &CloseError{Code: CloseAbnormalClosure, Text: err.Error()}
+	}
+	ws.conn.Close()
+	ws.readErr = err
+	return err
+}
+
+func closePayload(code int, reason string) []byte {
+	// control frame 最多 125 字节
+	if len(reason) > 123 {
+		reason = reason[:123]
+		for !utf8.ValidString(reason) {
+			reason = reason[:len(reason)-1]
+		}
+	}
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+	return payload
+}
+
+// writeFrame writes one unmasked frame, server frames are never masked
+func (ws *WebSocket) writeFrame(opcode int, fin bool, payload []byte) error {
+	ws.frameMu.Lock()
+	defer ws.frameMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		ws.closeSent = true
+	}
+
+	var header [10]byte
+	header[0] = byte(opcode)
+	if fin {
+		header[0] |= 0x80
+	}
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+		n = 4
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+		n = 10
+	}
+	if _, err := ws.bw.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := ws.bw.Write(payload); err != nil {
+		return err
+	}
+	return ws.bw.Flush()
+}
+
+// WriteMessage sends data as one text or binary message. It is safe to
+// call from several goroutines.
+func (ws *WebSocket) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return ws.WriteControl(messageType, data)
+	}
+	ws.msgMu.Lock()
+	defer ws.msgMu.Unlock()
+	return ws.writeFrame(messageType, true, data)
+}
+
+// WriteControl sends a ping, pong or close frame of at most 125 bytes
+func (ws *WebSocket) WriteControl(messageType int, data []byte) error {
+	if messageType != PingMessage && messageType != PongMessage && messageType != CloseMessage {
+		return fmt.Errorf("gee: invalid websocket message type %d", messageType)
+	}
+	if len(data) > 125 {
+		return errors.New("gee: websocket control frame longer than 125 bytes")
+	}
+	return ws.writeFrame(messageType, true, data)
+}
+
+// Ping sends a ping, the pong arrives through SetPongHandler
+func (ws *WebSocket) Ping(data []byte) error {
+	return ws.WriteControl(PingMessage, data)
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v
+func (ws *WebSocket) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WriteJSON sends v encoded as JSON in a text message
+func (ws *WebSocket) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(TextMessage, data)
+}
+
+// NextWriter returns a writer sending a message in fragments, one per
+// Write, finished by Close. Other messages wait until it is closed, pings
+// and pongs are still sent in between.
+func (ws *WebSocket) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, fmt.Errorf("gee: invalid websocket message type %d", messageType)
+	}
+	ws.msgMu.Lock()
+	return &fragmentWriter{ws: ws, opcode: messageType}, nil
+}
+
+type fragmentWriter struct {
+	ws     *WebSocket
+	opcode int // opContinuation after the first fragment
+	closed bool
+}
+
+func (w *fragmentWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("gee: websocket writer closed")
+	}
+	if err := w.ws.writeFrame(w.opcode, false, p); err != nil {
+		return 0, err
+	}
+	w.opcode = opContinuation
+	return len(p), nil
+}
+
+func (w *fragmentWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer w.ws.msgMu.Unlock()
+	return w.ws.writeFrame(w.opcode, true, nil)
+}
+
+// Close closes the connection normally, see CloseWithStatus
+func (ws *WebSocket) Close() error {
+	return ws.CloseWithStatus(CloseNormalClosure, "")
+}
+
+// CloseWithStatus sends a close frame with code and reason, waits a few
+// seconds for the close frame of the client to complete the handshake and
+// closes the connection. While a ReadMessage is running, in another
+// goroutine or in the pong handler calling CloseWithStatus, that reader
+// receives the reply instead (its ReadMessage returns a *CloseError) and
+// closes the connection, CloseWithStatus returns once the frame is sent.
+func (ws *WebSocket) CloseWithStatus(code int, reason string) error {
+	err := ws.writeFrame(CloseMessage, true, closePayload(code, reason))
+	if err == ErrCloseSent {
+		err = nil
+	}
+	// 同时也限制了正在 ReadMessage 中阻塞的读者, 它最多再等 closeTimeout
+	ws.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+	if !ws.readMu.TryLock() {
+		// 读者可能就是调用者自己 (pong handler), 等它会死锁
+		return err
+	}
+	for ws.readErr == nil {
+		// 丢弃剩下的消息, 直到对方的 close frame 或者超时
+		ws.readMessage()
+	}
+	ws.readMu.Unlock()
+	if closeErr := ws.conn.Close(); err == nil && !errors.Is(closeErr, net.ErrClosed) {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,338 @@
+package gee
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsClient speaks just enough of RFC 6455 to test the server side
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) (*wsClient, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req, _ := http.NewRequest("GET", server.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	// RFC 6455 中的示例 key
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &wsClient{t: t, conn: conn, br: br}, resp
+}
+
+func (c *wsClient) writeFrame(fin bool, opcode int, payload []byte, masked bool) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, byte(len(payload)))
+	default:
+		frame = append(frame, 126, byte(len(payload)>>8), byte(len(payload)))
+	}
+	data := append([]byte(nil), payload...)
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i := range data {
+			data[i] ^= mask[i%4]
+		}
+	}
+	if _, err := c.conn.Write(append(frame, data...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) readFrame() (fin bool, opcode int, payload []byte) {
+	var h [2]byte
+	if _, err := c.br.Read(h[:1]); err != nil {
+		c.t.Fatal(err)
+	}
+	if _, err := c.br.Read(h[1:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if h[1]&0x80 != 0 {
+		c.t.Fatal("server frames must not be masked")
+	}
+	n := int(h[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		c.br.Read(ext[:])
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload = make([]byte, n)
+	for read := 0; read < n; {
+		m, err := c.br.Read(payload[read:])
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		read += m
+	}
+	return h[0]&0x80 != 0, int(h[0] & 0x0f), payload
+}
+
+// expectClose reads the close frame of the server and returns its code
+func (c *wsClient) expectClose() int {
+	_, opcode, payload := c.readFrame()
+	if opcode != CloseMessage || len(payload) < 2 {
+		c.t.Fatalf("expected a close frame, got opcode %d %q", opcode, payload)
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func TestWebSocket(t *testing.T) {
+	result := make(chan error, 1)
+	r := New()
+	api := r.Group("/api")
+	api.Use(func(c *Context) {
+		if c.Req.Header.Get("X-Token") != "secret" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+		}
+	})
+	api.WS("/echo", func(c *Context, ws *WebSocket) {
+		for {
+			typ, msg, err := ws.ReadMessage()
+			if err != nil {
+				result <- err
+				return
+			}
+			ws.WriteMessage(typ, msg)
+		}
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// 中间件在握手之前拒绝
+	_, resp := dialWebSocket(t, server, "/api/echo", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 before the upgrade, got %d", resp.StatusCode)
+	}
+	plain := httptest.NewRecorder()
+	plainReq := httptest.NewRequest("GET", "/api/echo", nil)
+	plainReq.Header.Set("X-Token", "secret")
+	r.ServeHTTP(plain, plainReq)
+	if plain.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a plain GET, got %d", plain.Code)
+	}
+
+	client, resp := dialWebSocket(t, server, "/api/echo", http.Header{"X-Token": {"secret"}})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected Sec-WebSocket-Accept %q", accept)
+	}
+
+	client.writeFrame(true, TextMessage, []byte("hello"), true)
+	if _, opcode, payload := client.readFrame(); opcode != TextMessage || string(payload) != "hello" {
+		t.Errorf("expected echo of hello, got opcode %d %q", opcode, payload)
+	}
+
+	// 分片消息中间插入 ping: 先收到 pong, 再收到拼好的消息
+	client.writeFrame(false, BinaryMessage, []byte("frag"), true)
+	client.writeFrame(true, PingMessage, []byte("are you there"), true)
+	client.writeFrame(false, 0, []byte("men"), true)
+	client.writeFrame(true, 0, []byte(strings.Repeat("t", 200)), true)
+	if _, opcode, payload := client.readFrame(); opcode != PongMessage || string(payload) != "are you there" {
+		t.Errorf("expected pong, got opcode %d %q", opcode, payload)
+	}
+	if _, opcode, payload := client.readFrame(); opcode != BinaryMessage || string(payload) != "fragmen"+strings.Repeat("t", 200) {
+		t.Errorf("expected the joined message, got opcode %d %q", opcode, payload)
+	}
+
+	client.writeFrame(true, CloseMessage, []byte{0x03, 0xe8, 'b', 'y', 'e'}, true)
+	if code := client.expectClose(); code != CloseNormalClosure {
+		t.Errorf("expected the close frame to be echoed with 1000, got %d", code)
+	}
+	if err := <-result; !IsCloseError(err, CloseNormalClosure) || err.(*CloseError).Text != "bye" {
+		t.Errorf("expected close error 1000 bye, got %v", err)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	r := New()
+	r.WebSocket.MaxMessageSize = 16
+	r.WS("/ws", func(c *Context, ws *WebSocket) {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		frames func(c *wsClient)
+		code   int
+	}{
+		{"too big", func(c *wsClient) {
+			c.writeFrame(true, TextMessage, []byte(strings.Repeat("a", 32)), true)
+		}, CloseMessageTooBig},
+		{"too big in fragments", func(c *wsClient) {
+			c.writeFrame(false, TextMessage, []byte(strings.Repeat("a", 10)), true)
+			c.writeFrame(true, 0, []byte(strings.Repeat("a", 10)), true)
+		}, CloseMessageTooBig},
+		{"invalid utf-8", func(c *wsClient) {
+			c.writeFrame(true, TextMessage, []byte{0xff, 0xfe}, true)
+		}, CloseInvalidFramePayloadData},
+		{"unmasked", func(c *wsClient) {
+			c.writeFrame(true, TextMessage, []byte("hi"), false)
+		}, CloseProtocolError},
+		{"lone continuation", func(c *wsClient) {
+			c.writeFrame(true, 0, []byte("hi"), true)
+		}, CloseProtocolError},
+		{"unknown opcode", func(c *wsClient) {
+			c.writeFrame(true, 3, nil, true)
+		}, CloseProtocolError},
+	}
+	for _, tt := range tests {
+		client, resp := dialWebSocket(t, server, "/ws", nil)
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("%s: expected 101, got %d", tt.name, resp.StatusCode)
+		}
+		tt.frames(client)
+		if code := client.expectClose(); code != tt.code {
+			t.Errorf("%s: expected close code %d, got %d", tt.name, tt.code, code)
+		}
+		client.conn.Close()
+	}
+
+	_, resp := dialWebSocket(t, server, "/ws", http.Header{"Origin": {"https://evil.example"}})
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("cross origin handshake: expected 403, got %d", resp.StatusCode)
+	}
+}
+
+func TestWebSocketCloseWhileReading(t *testing.T) {
+	readErr := make(chan error, 1)
+	closed := make(chan error, 1)
+	r := New()
+	r.WS("/ws", func(c *Context, ws *WebSocket) {
+		go func() {
+			_, _, err := ws.ReadMessage()
+			readErr <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		closed <- ws.CloseWithStatus(CloseGoingAway, "restart")
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client, resp := dialWebSocket(t, server, "/ws", nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if code := client.expectClose(); code != CloseGoingAway {
+		t.Fatalf("expected close code %d, got %d", CloseGoingAway, code)
+	}
+	// 关闭握手的回应只会被读者收到一次
+	client.writeFrame(true, CloseMessage, closePayload(CloseGoingAway, ""), true)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("close failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CloseWithStatus did not return after the close reply")
+	}
+	if err := <-readErr; !IsCloseError(err, CloseGoingAway) {
+		t.Errorf("the reader should get the close reply, got %v", err)
+	}
+}
+
+func TestWebSocketUpgradeHeaders(t *testing.T) {
+	r := New()
+	r.Use(Compress(), func(c *Context) {
+		c.SetHeader("X-Request-Id", "abc")
+		c.SetHeader("Content-Length", "5")
+		c.SetHeader("Content-Encoding", "gzip")
+		c.SetHeader("Connection", "close")
+		c.SetCookie("session", "1", nil)
+	})
+	r.WS("/ws", func(c *Context, ws *WebSocket) {
+		ws.Close()
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	_, resp := dialWebSocket(t, server, "/ws", http.Header{"Accept-Encoding": {"gzip"}})
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Request-Id") != "abc" || len(resp.Cookies()) != 1 {
+		t.Errorf("headers set by middleware should be sent, got %v", resp.Header)
+	}
+	// 描述 body 或连接的响应头对 101 没有意义
+	for _, name := range []string{"Content-Length", "Content-Encoding", "Vary"} {
+		if value := resp.Header.Get(name); value != "" {
+			t.Errorf("%s should not be copied into the 101 response, got %q", name, value)
+		}
+	}
+	if values := resp.Header.Values("Connection"); len(values) != 1 || values[0] != "Upgrade" {
+		t.Errorf("expected only Connection: Upgrade, got %q", values)
+	}
+}
+
+func TestWebSocketCloseFromPongHandler(t *testing.T) {
+	readErr := make(chan error, 1)
+	r := New()
+	r.WS("/ws", func(c *Context, ws *WebSocket) {
+		ws.SetPongHandler(func([]byte) error {
+			// ReadMessage 还在进行中, Close 不能等它
+			return ws.CloseWithStatus(CloseGoingAway, "bye")
+		})
+		_, _, err := ws.ReadMessage()
+		readErr <- err
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client, resp := dialWebSocket(t, server, "/ws", nil)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	client.writeFrame(true, PongMessage, nil, true)
+	if code := client.expectClose(); code != CloseGoingAway {
+		t.Fatalf("expected close code %d, got %d", CloseGoingAway, code)
+	}
+	client.writeFrame(true, CloseMessage, closePayload(CloseGoingAway, ""), true)
+
+	select {
+	case err := <-readErr:
+		if !IsCloseError(err, CloseGoingAway) {
+			t.Errorf("the reader should get the close reply, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("closing from the pong handler deadlocked")
+	}
+}
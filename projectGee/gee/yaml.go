@@ -0,0 +1,328 @@
+package gee
+
+/*
+一个只负责输出的 YAML 编码器, 覆盖响应里常见的数据: 标量, map, slice, struct.
+struct 字段使用 yaml tag ("name,omitempty", "-"), 没有 tag 时用小写的字段名;
+map 按 key 排序, 字符串在可能被误读时 (数字, true, 含有特殊字符...) 加双引号.
+nil 的指针, map 和 slice 写成 null, 引用自身的值返回错误.
+*/
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeYAML writes v as a block style YAML document
+func encodeYAML(w io.Writer, v interface{}) error {
+	var buf bytes.Buffer
+	e := &yamlEncoder{buf: &buf}
+	if err := e.root(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type yamlEncoder struct {
+	buf *bytes.Buffer
+	// visiting holds the pointers, maps and slices on the way from the
+	// root to the value being written
+	visiting map[yamlRef]bool
+}
+
+// yamlRef identifies what a pointer, map or slice refers to
+type yamlRef struct {
+	ptr uintptr
+	typ reflect.Type
+	len int
+}
+
+type yamlEntry struct {
+	key   string
+	value reflect.Value
+}
+
+func (e *yamlEncoder) root(v reflect.Value) error {
+	leave, err := e.enter(v)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	v = yamlIndirect(v)
+	if entries, isMap, err := e.collection(v); err != nil {
+		return err
+	} else if len(entries) > 0 {
+		return e.block(entries, isMap, 0, "")
+	}
+	s, err := e.scalar(v)
+	if err != nil {
+		return err
+	}
+	e.buf.WriteString(s + "\n")
+	return nil
+}
+
+// value writes v after "key:" or "-", at nesting level indent
+func (e *yamlEncoder) value(v reflect.Value, indent int, inSequence bool) error {
+	leave, err := e.enter(v)
+	if err != nil {
+		return err
+	}
+	defer leave()
+	v = yamlIndirect(v)
+	entries, isMap, err := e.collection(v)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		s, err := e.scalar(v)
+		if err != nil {
+			return err
+		}
+		e.buf.WriteString(" " + s + "\n")
+		return nil
+	}
+	if inSequence {
+		// "- key: value" 和 "- - item" 的紧凑写法, 其余的项与第一个对齐
+		return e.block(entries, isMap, indent+2, " ")
+	}
+	e.buf.WriteByte('\n')
+	return e.block(entries, isMap, indent+2, strings.Repeat(" ", indent+2))
+}
+
+// enter records the pointer, map or slice v until leave is called. Meeting
+// it again before that means v contains itself, which would never end.
+func (e *yamlEncoder) enter(v reflect.Value) (leave func(), err error) {
+	for v.IsValid() && v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return func() {}, nil
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice:
+		if v.IsNil() || v.Kind() == reflect.Slice && v.Len() == 0 {
+			return func() {}, nil
+		}
+	default:
+		return func() {}, nil
+	}
+	ref := yamlRef{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		ref.len = v.Len()
+	}
+	if e.visiting[ref] {
+		return nil, fmt.Errorf("gee: cannot encode %s as YAML, it refers to itself", v.Type())
+	}
+	if e.visiting == nil {
+		e.visiting = make(map[yamlRef]bool)
+	}
+	e.visiting[ref] = true
+	return func() { delete(e.visiting, ref) }, nil
+}
+
+// block writes the entries of a map (key: value) or a sequence (- value).
+// first is written before the first entry instead of the indentation.
+func (e *yamlEncoder) block(entries []yamlEntry, isMap bool, indent int, first string) error {
+	for i, entry := range entries {
+		if i == 0 {
+			e.buf.WriteString(first)
+		} else {
+			e.buf.WriteString(strings.Repeat(" ", indent))
+		}
+		if isMap {
+			e.buf.WriteString(yamlString(entry.key) + ":")
+		} else {
+			e.buf.WriteByte('-')
+		}
+		if err := e.value(entry.value, indent, !isMap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collection returns the entries of a non-empty map, struct, slice or
+// array, isMap is false for sequences. Scalars and empty collections
+// return no entries.
+func (e *yamlEncoder) collection(v reflect.Value) (entries []yamlEntry, isMap bool, err error) {
+	if !v.IsValid() || yamlIsScalarType(v) {
+		return nil, false, nil
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, true, nil
+		}
+		for iter := v.MapRange(); iter.Next(); {
+			entries = append(entries, yamlEntry{key: fmt.Sprint(iter.Key().Interface()), value: iter.Value()})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+		return entries, true, nil
+	case reflect.Struct:
+		return yamlStructFields(v, nil), true, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false, nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			entries = append(entries, yamlEntry{value: v.Index(i)})
+		}
+		return entries, false, nil
+	}
+	return nil, false, nil
+}
+
+// yamlStructFields lists the exported fields, flattening embedded structs
+func yamlStructFields(v reflect.Value, entries []yamlEntry) []yamlEntry {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+		if field.Anonymous && name == "" {
+			if inner := yamlIndirect(fv); inner.IsValid() && inner.Kind() == reflect.Struct && !yamlIsScalarType(inner) {
+				entries = yamlStructFields(inner, entries)
+				continue
+			}
+		}
+		if opts == "omitempty" && fv.IsZero() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		entries = append(entries, yamlEntry{key: name, value: fv})
+	}
+	return entries
+}
+
+func yamlIndirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		if v.Type().Implements(textMarshalerType) {
+			return v
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var (
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	yamlTimeType      = reflect.TypeOf(time.Time{})
+)
+
+// yamlIsScalarType reports whether v is written as a single value even
+// though it may be a struct, e.g. time.Time
+func yamlIsScalarType(v reflect.Value) bool {
+	return v.Type() == yamlTimeType || v.Type().Implements(textMarshalerType)
+}
+
+func (e *yamlEncoder) scalar(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "null", nil
+	}
+	if v.Type() == yamlTimeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return "null", nil
+		}
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return yamlString(string(text)), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsNaN(f):
+			return ".nan", nil
+		case math.IsInf(f, 1):
+			return ".inf", nil
+		case math.IsInf(f, -1):
+			return "-.inf", nil
+		}
+		return strconv.FormatFloat(f, 'g', -1, v.Type().Bits()), nil
+	case reflect.String:
+		return yamlString(v.String()), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return "null", nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return yamlString(string(v.Bytes())), nil
+		}
+		return "[]", nil
+	case reflect.Array:
+		return "[]", nil
+	case reflect.Map:
+		if v.IsNil() {
+			return "null", nil
+		}
+		return "{}", nil
+	case reflect.Struct:
+		return "{}", nil
+	}
+	return "", fmt.Errorf("gee: cannot encode %s as YAML", v.Type())
+}
+
+// yamlString returns s plain when it cannot be read as anything else,
+// double quoted otherwise
+func yamlString(s string) string {
+	if yamlPlain(s) {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+func yamlPlain(s string) bool {
+	if s == "" || s[0] == '-' || s[0] == '.' || s[len(s)-1] == ' ' || s[0] == ' ' {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("_-./ ()+", r)) {
+			return false
+		}
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~":
+		return false
+	}
+	// 看起来像数字的字符串需要引号, 否则会被读成数字
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return false
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return false
+	}
+	return true
+}
@@ -16,5 +16,6 @@ func main() {
 		c.String(http.StatusOK, names[100])
 	})
 
-	r.RUN(":9999")
+	r.HandleSignals = true
+	r.Run(":9999")
 }
\ No newline at end of file